@@ -16,47 +16,69 @@ import (
 // Mux. The library transforms the proxy event into an HTTP request and then
 // creates a proxy response object from the http.ResponseWriter
 type ChiLambda struct {
-	core.RequestAccessor
+	*core.RequestAccessor
 
 	chiMux *chi.Mux
+	lazy   *core.LazyInit[*chi.Mux]
 }
 
 // New creates a new instance of the ChiLambda object.
 // Receives an initialized *chi.Mux object - normally created with chi.NewRouter().
-// It returns the initialized instance of the ChiLambda object.
-func New(chi *chi.Mux) *ChiLambda {
-	return &ChiLambda{chiMux: chi}
+// Options configure the embedded core.RequestAccessor, see core.Option.
+// It returns the initialized instance of the ChiLambda object, which is safe
+// for concurrent use by multiple goroutines.
+func New(chi *chi.Mux, opts ...core.Option) *ChiLambda {
+	return &ChiLambda{RequestAccessor: core.NewRequestAccessor(opts...), chiMux: chi}
+}
+
+// NewLazy creates a new instance of the ChiLambda object that builds its
+// *chi.Mux with factory when the first event arrives, so that expensive
+// setup is not paid before the function is invoked. Events fail with 503
+// Service Unavailable while the factory returns an error, and the factory
+// is retried on the next event.
+func NewLazy(factory func() (*chi.Mux, error), opts ...core.Option) *ChiLambda {
+	return &ChiLambda{RequestAccessor: core.NewRequestAccessor(opts...), lazy: core.NewLazyInit(factory)}
 }
 
 // Proxy receives an API Gateway proxy event, transforms it into an http.Request
 // object, and sends it to the chi.Mux for routing.
 // It returns a proxy response object generated from the http.ResponseWriter.
+// Handlers must not keep the http.ResponseWriter after they return, it is
+// reused for later events.
 func (g *ChiLambda) Proxy(req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
-	chiRequest, err := g.ProxyEventToHTTPRequest(req)
-	return g.proxyInternal(chiRequest, err)
+	return g.ServeEvent(http.HandlerFunc(g.serveHTTP), req)
 }
 
 // ProxyWithContext receives context and an API Gateway proxy event,
 // transforms them into an http.Request object, and sends it to the chi.Mux for routing.
 // It returns a proxy response object generated from the http.ResponseWriter.
+// Handlers must not keep the http.ResponseWriter after they return, it is
+// reused for later events.
 func (g *ChiLambda) ProxyWithContext(ctx context.Context, req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
-	chiRequest, err := g.EventToRequestWithContext(ctx, req)
-	return g.proxyInternal(chiRequest, err)
+	return g.ServeEventWithContext(ctx, http.HandlerFunc(g.serveHTTP), req)
 }
 
-func (g *ChiLambda) proxyInternal(chiRequest *http.Request, err error) (events.APIGatewayResponse, error) {
-
-	if err != nil {
-		return core.GatewayTimeout(), core.NewLoggedError("Could not convert proxy event to request: %v", err)
+// serveHTTP routes the request with a routing context we own, when the
+// route is used, so the matched route pattern can be read once the mux is
+// done with it.
+func (g *ChiLambda) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	mux := g.chiMux
+	if g.lazy != nil {
+		var err error
+		if mux, err = g.lazy.Get(req.Context()); err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
 	}
-
-	respWriter := core.NewProxyResponseWriter()
-	g.chiMux.ServeHTTP(http.ResponseWriter(respWriter), chiRequest)
-
-	proxyResponse, err := respWriter.GetProxyResponse()
-	if err != nil {
-		return core.GatewayTimeout(), core.NewLoggedError("Error while generating proxy response: %v", err)
+	if !core.WantsRoute(req) {
+		mux.ServeHTTP(w, req)
+		return
 	}
-
-	return proxyResponse, nil
+	// chi uses an existing routing context as is, so it needs the routes
+	// the mux would have set, for middleware such as GetHead.
+	rctx := chi.NewRouteContext()
+	rctx.Routes = mux
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	mux.ServeHTTP(w, req)
+	core.SetRoute(req, rctx.RoutePattern())
 }
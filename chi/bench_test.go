@@ -0,0 +1,39 @@
+package chiadapter_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi"
+	chiadapter "github.com/linthan/scf-go-api-proxy/chi"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+)
+
+func BenchmarkProxyWithContext(b *testing.B) {
+	mux := chi.NewRouter()
+	mux.Post("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(body)
+	})
+	adapter := chiadapter.New(mux)
+	event := coretest.NewEvent("POST", "/orders/42").
+		Header("Content-Type", "application/json").
+		Header("Accept", "application/json").
+		Query("expand", "items").
+		Body(`{"id":42,"name":"gopher","tags":["serverless","api","go"]}`).
+		Build()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := adapter.ProxyWithContext(ctx, event)
+		if err != nil || resp.StatusCode != 200 {
+			b.Fatal(resp, err)
+		}
+	}
+}
@@ -2,14 +2,24 @@ package chiadapter_test
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	chiadapter "github.com/linthan/scf-go-api-proxy/chi"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/tencentyun/scf-go-lib/events"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ = Describe("ChiLambda tests", func() {
@@ -39,4 +49,150 @@ var _ = Describe("ChiLambda tests", func() {
 			Expect(resp.StatusCode).To(Equal(200))
 		})
 	})
+
+	Context("Concurrent invocations", func() {
+		It("Serves parallel events without sharing state", func() {
+			r := chi.NewRouter()
+			r.Get("/echo/{id}", func(w http.ResponseWriter, r *http.Request) {
+				apiGwContext, _ := core.GetAPIGatewayContextFromContext(r.Context())
+				w.Write([]byte(chi.URLParam(r, "id") + ":" + r.URL.Query().Get("id") + ":" + apiGwContext.RequestID))
+			})
+
+			adapter := chiadapter.New(r, core.WithBasePath("/api"))
+
+			const invocations = 500
+			var wg sync.WaitGroup
+			errs := make(chan error, invocations)
+			for i := 0; i < invocations; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					id := strconv.Itoa(i)
+					req := coretest.NewEvent("GET", "/api/echo/"+id).Query("id", id).RequestID(id).Stage("prod").Build()
+					resp, err := adapter.ProxyWithContext(context.Background(), req)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if resp.StatusCode != 200 || resp.Body != id+":"+id+":"+id {
+						errs <- fmt.Errorf("invocation %s got %d %q", id, resp.StatusCode, resp.Body)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				Expect(err).To(BeNil())
+			}
+		})
+	})
+
+	Context("Encoded path segments", func() {
+		It("Routes on the original encoding of the path", func() {
+			r := chi.NewRouter()
+			r.Get("/files/{name}", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(chi.URLParam(r, "name")))
+			})
+
+			adapter := chiadapter.New(r)
+
+			req := coretest.NewEvent("GET", "/files/a%2Fb").Build()
+
+			resp, err := adapter.ProxyWithContext(context.Background(), req)
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(resp.Body).To(Equal("a%2Fb"))
+		})
+	})
+
+	Context("Route templates", func() {
+		It("Names spans after the matched route", func() {
+			r := chi.NewRouter()
+			r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(chi.URLParam(r, "id")))
+			})
+			r.Get("/users/me", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("me"))
+			})
+
+			exporter := tracetest.NewInMemoryExporter()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			adapter := chiadapter.New(r, core.WithTracerProvider(provider))
+
+			for _, path := range []string{"/users/42", "/users/me"} {
+				resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", path).Build())
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(Equal(200))
+			}
+
+			names := []string{}
+			for _, span := range exporter.GetSpans() {
+				if span.SpanKind == trace.SpanKindServer {
+					names = append(names, span.Name)
+				}
+			}
+			Expect(names).To(Equal([]string{"GET /users/{id}", "GET /users/me"}))
+		})
+	})
+
+	Context("HEAD requests", func() {
+		It("Routes them with GetHead whether or not the route is recorded", func() {
+			r := chi.NewRouter()
+			r.Use(middleware.GetHead)
+			r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("pong"))
+			})
+			sink := &core.MemoryMetricsSink{}
+
+			for _, adapter := range []*chiadapter.ChiLambda{chiadapter.New(r), chiadapter.New(r, core.WithMetrics(sink))} {
+				resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("HEAD", "/ping").Build())
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(Equal(200))
+			}
+			Expect(sink.Metrics()).To(HaveLen(1))
+			Expect(sink.Metrics()[0].Route).To(Equal("/ping"))
+		})
+	})
+
+	Context("Lazy initialization", func() {
+		It("Builds the mux on the first event", func() {
+			built := false
+			adapter := chiadapter.NewLazy(func() (*chi.Mux, error) {
+				built = true
+				r := chi.NewRouter()
+				r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("pong"))
+				})
+				return r, nil
+			})
+			Expect(built).To(BeFalse())
+
+			resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", "/ping").Build())
+			Expect(err).To(BeNil())
+			Expect(built).To(BeTrue())
+			Expect(resp.Body).To(Equal("pong"))
+		})
+	})
+
+	Context("Path rules", func() {
+		It("Applies IP rules to dot segment and encoded paths", func() {
+			r := chi.NewRouter()
+			r.Get("/admin/*", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("admin"))
+			})
+			r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("public"))
+			})
+			adapter := chiadapter.New(r, core.WithIPFilter(core.IPRule{PathPrefix: "/admin", Allow: []string{"10.0.0.0/8"}}))
+			proxy := func(path string) int {
+				resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", path).SourceIP("1.2.3.4").Build())
+				Expect(err).To(BeNil())
+				return resp.StatusCode
+			}
+			for _, path := range []string{"/admin/x", "/admin/../x", "/admin/%2e%2e/x", "/%61dmin/x", "/x/../admin/y"} {
+				Expect(proxy(path)).To(Equal(403), path)
+			}
+			Expect(proxy("/x")).To(Equal(200))
+		})
+	})
 })
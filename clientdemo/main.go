@@ -3,14 +3,17 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+
+	"github.com/linthan/scf-go-api-proxy/core"
 
 	"github.com/spf13/viper"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
 	scf "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/scf/v20180416"
-	"github.com/tencentyun/scf-go-lib/events"
 )
 
 func main() {
@@ -37,12 +40,15 @@ func main() {
 	request := scf.NewInvokeRequest()
 	request.FunctionName = common.StringPtr("simple")
 	request.InvocationType = common.StringPtr("RequestResponse") //# 接口参数,输入需要调用的函数名，RequestResponse(同步) 和 Event(异步)
-	event := events.APIGatewayRequest{}
-	event.Body = `{"a":1}`
-	event.Method = "POST"
-	event.Path = "/hello"
-	event.Context.Method = "/POST"
-	event.Context.Path = "/hello"
+	req, err := http.NewRequest(http.MethodPost, "/hello", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	event, err := core.RequestToEvent(req)
+	if err != nil {
+		panic(err)
+	}
 	eventb, _ := json.Marshal(event)
 	request.ClientContext = common.StringPtr(string(eventb))
 
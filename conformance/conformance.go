@@ -0,0 +1,254 @@
+// Package conformance checks that the adapters turn the same API Gateway
+// events into the same responses. Every adapter serves Handler on all paths
+// and replays the golden fixtures through Run, and serves the routes
+// documented on RunRoutes, registered with the router and middleware of its
+// framework, through RunRoutes. A new adapter joins the suite with an
+// Adapter and a RoutedAdapter entry in conformance_test.go.
+package conformance
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+//go:embed testdata/*.json testdata/routes/*.json
+var testdata embed.FS
+
+// Proxy serves an API Gateway event, as the ProxyWithContext method of the
+// adapters does.
+type Proxy func(context.Context, events.APIGatewayRequest) (events.APIGatewayResponse, error)
+
+// Adapter returns a Proxy serving h on every path and method through the
+// adapter under test. The fixtures mark binary bodies with
+// core.Base64EncodedHeader, as events sent by another process are, so the
+// adapter must be created with core.WithBase64Header.
+type Adapter func(h http.Handler) Proxy
+
+// RoutedAdapter returns a Proxy serving the routes documented on RunRoutes,
+// registered with the router and middleware of the framework under test.
+type RoutedAdapter func() Proxy
+
+// Suite registers an adapter with the conformance suite. Routes is
+// optional, adapters without it are only checked by Run.
+type Suite struct {
+	Adapter Adapter
+	Routes  RoutedAdapter
+}
+
+// RunSuite runs Run with the adapter and RunRoutes with its routes, when it
+// has them, in subtests named "handler" and "routes".
+func RunSuite(t *testing.T, suite Suite) {
+	t.Run("handler", func(t *testing.T) {
+		Run(t, suite.Adapter)
+	})
+	if suite.Routes != nil {
+		t.Run("routes", func(t *testing.T) {
+			RunRoutes(t, suite.Routes)
+		})
+	}
+}
+
+// Fixture is a golden event and the response every adapter must return for
+// it. Error is set when the proxy must also return an error. Limitation
+// notes where the golden response records the current behaviour of the
+// adapters rather than the behaviour of a real HTTP server; it is still
+// compared like any other.
+type Fixture struct {
+	Name       string                    `json:"-"`
+	Request    events.APIGatewayRequest  `json:"request"`
+	Response   events.APIGatewayResponse `json:"response"`
+	Error      bool                      `json:"error,omitempty"`
+	Limitation string                    `json:"limitation,omitempty"`
+}
+
+// Fixtures returns the golden fixtures of Run, in testdata, sorted by name.
+func Fixtures() ([]Fixture, error) {
+	return loadFixtures("testdata")
+}
+
+// RouteFixtures returns the golden fixtures of RunRoutes, in
+// testdata/routes, sorted by name.
+func RouteFixtures() ([]Fixture, error) {
+	return loadFixtures("testdata/routes")
+}
+
+func loadFixtures(dir string) ([]Fixture, error) {
+	entries, err := testdata.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fixtures := make([]Fixture, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		b, err := testdata.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var fixture Fixture
+		if err := json.Unmarshal(b, &fixture); err != nil {
+			return nil, err
+		}
+		fixture.Name = strings.TrimSuffix(entry.Name(), ".json")
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// Run replays every fixture through the adapter, in a subtest named after
+// the fixture, and reports the responses that differ from the golden ones.
+func Run(t *testing.T, adapter Adapter) {
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatalf("could not load fixtures: %v", err)
+	}
+	replay(t, adapter(Handler()), fixtures)
+}
+
+// RunRoutes replays every route fixture through the adapter, in a subtest
+// named after the fixture. The adapter registers these routes with its
+// framework:
+//
+//	GET  /users/{id}       200 text/plain "user <id>"
+//	POST /users            201 with the request body and Content-Type
+//	GET  /files/{path...}  200 text/plain with the path after /files/
+//
+// Every route writes Content-Type "text/plain; charset=utf-8" for plain
+// text, unknown paths get 404 text/plain "not found" and known paths
+// requested with another method 405 text/plain "method not allowed", from
+// the not found and method not allowed handlers of the framework. A
+// framework middleware sets "X-Conformance-Middleware: 1" on every
+// response, including the 404 and 405 ones.
+func RunRoutes(t *testing.T, adapter RoutedAdapter) {
+	fixtures, err := RouteFixtures()
+	if err != nil {
+		t.Fatalf("could not load route fixtures: %v", err)
+	}
+	replay(t, adapter(), fixtures)
+}
+
+func replay(t *testing.T, proxy Proxy, fixtures []Fixture) {
+	for _, fixture := range fixtures {
+		fixture := fixture
+		t.Run(fixture.Name, func(t *testing.T) {
+			resp, err := proxy(context.Background(), fixture.Request)
+			if fixture.Error && err == nil {
+				t.Errorf("expected an error, got none")
+			}
+			if !fixture.Error && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(normalize(resp), normalize(fixture.Response)) {
+				got, _ := json.MarshalIndent(resp, "", "  ")
+				want, _ := json.MarshalIndent(fixture.Response, "", "  ")
+				t.Errorf("response differs from golden output\ngot:  %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+// normalize treats a nil and an empty header map as equal.
+func normalize(resp events.APIGatewayResponse) events.APIGatewayResponse {
+	if len(resp.Headers) == 0 {
+		resp.Headers = nil
+	}
+	return resp
+}
+
+// Handler returns the application every adapter serves in the suite:
+//
+//	/ping           200 "pong"
+//	/echo/...       the request as JSON: method, paths, host, query, headers and body
+//	/upload         the request body as application/octet-stream
+//	/binary         256 bytes of image/png
+//	/cookies        the request cookies as JSON, setting a session cookie
+//	/headers        a multi-value response header
+//	/status/<code>  an empty response with the status code
+//
+// Other paths are not found.
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	switch p := r.URL.Path; {
+	case p == "/ping":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "pong")
+	case p == "/echo" || strings.HasPrefix(p, "/echo/"):
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"method":  r.Method,
+			"path":    r.URL.Path,
+			"rawPath": r.URL.EscapedPath(),
+			"host":    r.Host,
+			"query":   r.URL.Query(),
+			"headers": r.Header,
+			"body":    string(body),
+		})
+	case p == "/upload":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	case p == "/binary":
+		body := make([]byte, 256)
+		for i := range body {
+			body[i] = byte(i)
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	case p == "/cookies":
+		cookies := map[string]string{}
+		for _, c := range r.Cookies() {
+			cookies[c.Name] = c.Value
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/", HttpOnly: true})
+		writeJSON(w, cookies)
+	case p == "/headers":
+		w.Header().Add("X-Multi", "first")
+		w.Header().Add("X-Multi", "second")
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(p, "/status/"):
+		code, err := strconv.Atoi(strings.TrimPrefix(p, "/status/"))
+		if err != nil || code < 100 || code > 999 {
+			http.Error(w, "invalid status code", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(code)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
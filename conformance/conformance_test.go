@@ -0,0 +1,172 @@
+package conformance_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-chi/chi"
+	"github.com/labstack/echo/v4"
+	chiadapter "github.com/linthan/scf-go-api-proxy/chi"
+	"github.com/linthan/scf-go-api-proxy/conformance"
+	"github.com/linthan/scf-go-api-proxy/core"
+	echoadapter "github.com/linthan/scf-go-api-proxy/echo"
+	ginadapter "github.com/linthan/scf-go-api-proxy/gin"
+)
+
+// adapters lists the adapters checked by the suite, one entry each.
+var adapters = map[string]conformance.Suite{
+	"gin":  {Adapter: ginProxy, Routes: ginRoutedProxy},
+	"chi":  {Adapter: chiProxy, Routes: chiRoutedProxy},
+	"echo": {Adapter: echoProxy, Routes: echoRoutedProxy},
+}
+
+func TestConformance(t *testing.T) {
+	for name, suite := range adapters {
+		suite := suite
+		t.Run(name, func(t *testing.T) {
+			conformance.RunSuite(t, suite)
+		})
+	}
+}
+
+func ginProxy(h http.Handler) conformance.Proxy {
+	return ginadapter.New(ginEngine(h), core.WithBase64Header()).ProxyWithContext
+}
+
+func ginRoutedProxy() conformance.Proxy {
+	return ginadapter.New(ginRoutes()).ProxyWithContext
+}
+
+func chiProxy(h http.Handler) conformance.Proxy {
+	return chiadapter.New(chiMux(h), core.WithBase64Header()).ProxyWithContext
+}
+
+func chiRoutedProxy() conformance.Proxy {
+	return chiadapter.New(chiRoutes()).ProxyWithContext
+}
+
+func echoProxy(h http.Handler) conformance.Proxy {
+	return echoadapter.New(echoServer(h), core.WithBase64Header()).ProxyWithContext
+}
+
+func echoRoutedProxy() conformance.Proxy {
+	return echoadapter.New(echoRoutes()).ProxyWithContext
+}
+
+const (
+	textPlain        = "text/plain; charset=utf-8"
+	middlewareHeader = "X-Conformance-Middleware"
+)
+
+func ginEngine(h http.Handler) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	engine.Any("/*path", gin.WrapH(h))
+	return engine
+}
+
+func chiMux(h http.Handler) *chi.Mux {
+	mux := chi.NewRouter()
+	mux.Handle("/*", h)
+	return mux
+}
+
+func echoServer(h http.Handler) *echo.Echo {
+	e := echo.New()
+	e.Any("/*", echo.WrapHandler(h))
+	return e
+}
+
+func ginRoutes() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	engine.HandleMethodNotAllowed = true
+	engine.Use(func(c *gin.Context) {
+		c.Header(middlewareHeader, "1")
+		c.Next()
+	})
+	engine.GET("/users/:id", func(c *gin.Context) {
+		c.Data(http.StatusOK, textPlain, []byte("user "+c.Param("id")))
+	})
+	engine.POST("/users", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusCreated, c.ContentType(), body)
+	})
+	engine.GET("/files/*path", func(c *gin.Context) {
+		c.Data(http.StatusOK, textPlain, []byte(strings.TrimPrefix(c.Param("path"), "/")))
+	})
+	engine.NoRoute(func(c *gin.Context) {
+		c.Data(http.StatusNotFound, textPlain, []byte("not found"))
+	})
+	engine.NoMethod(func(c *gin.Context) {
+		c.Data(http.StatusMethodNotAllowed, textPlain, []byte("method not allowed"))
+	})
+	return engine
+}
+
+func chiRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(middlewareHeader, "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	mux.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeText(w, http.StatusOK, "user "+chi.URLParam(r, "id"))
+	})
+	mux.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+	mux.Get("/files/*", func(w http.ResponseWriter, r *http.Request) {
+		writeText(w, http.StatusOK, chi.URLParam(r, "*"))
+	})
+	mux.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeText(w, http.StatusNotFound, "not found")
+	})
+	mux.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeText(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+	return mux
+}
+
+func writeText(w http.ResponseWriter, code int, text string) {
+	w.Header().Set("Content-Type", textPlain)
+	w.WriteHeader(code)
+	io.WriteString(w, text)
+}
+
+func echoRoutes() *echo.Echo {
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set(middlewareHeader, "1")
+			return next(c)
+		}
+	})
+	e.GET("/users/:id", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, textPlain, []byte("user "+c.Param("id")))
+	})
+	e.POST("/users", func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.Blob(http.StatusCreated, c.Request().Header.Get("Content-Type"), body)
+	})
+	e.GET("/files/*", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, textPlain, []byte(c.Param("*")))
+	})
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		code := http.StatusInternalServerError
+		if he, ok := err.(*echo.HTTPError); ok {
+			code = he.Code
+		}
+		text := strings.ToLower(http.StatusText(code))
+		c.Blob(code, textPlain, []byte(text))
+	}
+	return e
+}
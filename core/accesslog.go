@@ -0,0 +1,251 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+// AccessLogFormat selects the layout of access log lines.
+type AccessLogFormat int
+
+const (
+	// AccessLogCommon is the Common Log Format followed by the API Gateway
+	// request ID, the function request ID and the latency in milliseconds.
+	AccessLogCommon AccessLogFormat = iota
+	// AccessLogCombined is the Combined Log Format, which adds the referer
+	// and user agent to AccessLogCommon.
+	AccessLogCombined
+	// AccessLogJSON writes one JSON object per line.
+	AccessLogJSON
+)
+
+// Names of the access log fields, as used in AccessLogJSON lines and in
+// AccessLogConfig.RedactFields.
+const (
+	AccessLogFieldTime              = "time"
+	AccessLogFieldSourceIP          = "source_ip"
+	AccessLogFieldMethod            = "method"
+	AccessLogFieldPath              = "path"
+	AccessLogFieldStatus            = "status"
+	AccessLogFieldBytes             = "bytes"
+	AccessLogFieldReferer           = "referer"
+	AccessLogFieldUserAgent         = "user_agent"
+	AccessLogFieldLatencyMs         = "latency_ms"
+	AccessLogFieldRequestID         = "request_id"
+	AccessLogFieldFunctionRequestID = "function_request_id"
+	AccessLogFieldStage             = "stage"
+	AccessLogFieldRoute             = "route"
+)
+
+const redacted = "[REDACTED]"
+
+// AccessLogConfig configures the access log written by WithAccessLog.
+type AccessLogConfig struct {
+	// Format of the log lines, AccessLogCommon by default.
+	Format AccessLogFormat
+	// Writer receives the log lines, os.Stdout when nil.
+	Writer io.Writer
+	// SampleRate is the fraction of requests that are logged, between 0
+	// and 1. Zero, the default, logs every request.
+	SampleRate float64
+	// AlwaysLogErrors logs responses with a 5xx status even when they are
+	// not sampled.
+	AlwaysLogErrors bool
+	// RedactFields lists fields, by their AccessLogField name, whose value
+	// is replaced with "[REDACTED]". Every field but the numeric status,
+	// bytes and latency_ms can be redacted; WithAccessLog panics on the
+	// others and on unknown names.
+	RedactFields []string
+	// RedactQueryParams lists query string parameters whose values are
+	// replaced with "[REDACTED]" in the logged path.
+	RedactQueryParams []string
+}
+
+// WithAccessLog writes an access log line for every invocation, including
+// the ones answered by the library itself.
+func WithAccessLog(cfg AccessLogConfig) Option {
+	l := newAccessLogger(cfg)
+	return func(c *config) {
+		c.accessLog = l
+	}
+}
+
+type accessLogger struct {
+	cfg          AccessLogConfig
+	redactFields map[string]bool
+	redactParams map[string]bool
+	mu           sync.Mutex
+}
+
+func newAccessLogger(cfg AccessLogConfig) *accessLogger {
+	if cfg.Writer == nil {
+		cfg.Writer = os.Stdout
+	}
+	l := &accessLogger{cfg: cfg, redactFields: map[string]bool{}, redactParams: map[string]bool{}}
+	for _, f := range cfg.RedactFields {
+		if _, ok := redactableFields[f]; !ok {
+			panic(fmt.Sprintf("core: access log field %q cannot be redacted", f))
+		}
+		l.redactFields[f] = true
+	}
+	for _, p := range cfg.RedactQueryParams {
+		l.redactParams[p] = true
+	}
+	return l
+}
+
+type accessLogEntry struct {
+	Time              string  `json:"time"`
+	SourceIP          string  `json:"source_ip"`
+	Method            string  `json:"method"`
+	Path              string  `json:"path"`
+	Status            int     `json:"status"`
+	Bytes             int     `json:"bytes"`
+	Referer           string  `json:"referer"`
+	UserAgent         string  `json:"user_agent"`
+	LatencyMs         float64 `json:"latency_ms"`
+	RequestID         string  `json:"request_id"`
+	FunctionRequestID string  `json:"function_request_id"`
+	Stage             string  `json:"stage"`
+	Route             string  `json:"route"`
+}
+
+func (l *accessLogger) sampled(status int) bool {
+	if l.cfg.SampleRate <= 0 || l.cfg.SampleRate >= 1 {
+		return true
+	}
+	if l.cfg.AlwaysLogErrors && status >= 500 {
+		return true
+	}
+	return rand.Float64() < l.cfg.SampleRate
+}
+
+func (l *accessLogger) log(ctx context.Context, req events.APIGatewayRequest, inv *invocation, status int, start time.Time, latency time.Duration) {
+	if !l.sampled(status) {
+		return
+	}
+
+	entry := accessLogEntry{
+		Time:      start.UTC().Format(time.RFC3339Nano),
+		SourceIP:  req.Context.SourceIP,
+		Method:    req.Method,
+		Path:      l.path(req),
+		Status:    status,
+		Bytes:     inv.responseBytes,
+		Referer:   eventHeader(req, "Referer"),
+		UserAgent: eventHeader(req, "User-Agent"),
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		RequestID: req.Context.RequestID,
+		Stage:     req.Context.Stage,
+		Route:     inv.route,
+	}
+	if lc, ok := functioncontext.FromContext(ctx); ok && lc != nil {
+		entry.FunctionRequestID = lc.RequestID
+	}
+	l.redact(&entry)
+
+	var line []byte
+	if l.cfg.Format == AccessLogJSON {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			return
+		}
+	} else {
+		line = []byte(l.clf(entry, start))
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg.Writer.Write(line)
+}
+
+func (l *accessLogger) path(req events.APIGatewayRequest) string {
+	if len(req.QueryString) == 0 {
+		return req.Path
+	}
+	values := url.Values{}
+	for k, v := range req.QueryString {
+		if l.redactParams[k] {
+			values[k] = []string{redacted}
+			continue
+		}
+		values[k] = v
+	}
+	return req.Path + "?" + values.Encode()
+}
+
+// redactableFields returns the string fields of an entry by name.
+var redactableFields = map[string]func(e *accessLogEntry) *string{
+	AccessLogFieldTime:              func(e *accessLogEntry) *string { return &e.Time },
+	AccessLogFieldSourceIP:          func(e *accessLogEntry) *string { return &e.SourceIP },
+	AccessLogFieldMethod:            func(e *accessLogEntry) *string { return &e.Method },
+	AccessLogFieldPath:              func(e *accessLogEntry) *string { return &e.Path },
+	AccessLogFieldReferer:           func(e *accessLogEntry) *string { return &e.Referer },
+	AccessLogFieldUserAgent:         func(e *accessLogEntry) *string { return &e.UserAgent },
+	AccessLogFieldRequestID:         func(e *accessLogEntry) *string { return &e.RequestID },
+	AccessLogFieldFunctionRequestID: func(e *accessLogEntry) *string { return &e.FunctionRequestID },
+	AccessLogFieldStage:             func(e *accessLogEntry) *string { return &e.Stage },
+	AccessLogFieldRoute:             func(e *accessLogEntry) *string { return &e.Route },
+}
+
+func (l *accessLogger) redact(e *accessLogEntry) {
+	for name := range l.redactFields {
+		*redactableFields[name](e) = redacted
+	}
+}
+
+// clf formats the entry in Common or Combined Log Format.
+func (l *accessLogger) clf(e accessLogEntry, start time.Time) string {
+	timestamp := start.Format("02/Jan/2006:15:04:05 -0700")
+	if e.Time == redacted {
+		timestamp = redacted
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s - - [%s] \"%s %s HTTP/1.1\" %d %s",
+		dashIfEmpty(e.SourceIP), timestamp, e.Method, e.Path, e.Status, clfBytes(e.Bytes))
+	if l.cfg.Format == AccessLogCombined {
+		fmt.Fprintf(b, " %q %q", dashIfEmpty(e.Referer), dashIfEmpty(e.UserAgent))
+	}
+	fmt.Fprintf(b, " %q %q %.3f", dashIfEmpty(e.RequestID), dashIfEmpty(e.FunctionRequestID), e.LatencyMs)
+	return b.String()
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func clfBytes(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
+
+// eventHeader looks up a header of the event ignoring the case of its name.
+func eventHeader(req events.APIGatewayRequest, name string) string {
+	if v, ok := req.Headers[name]; ok {
+		return v
+	}
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+var _ = Describe("Access log tests", func() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	request := func(path string) events.APIGatewayRequest {
+		req := coretest.NewEvent("GET", path).Build()
+		req.Headers = map[string]string{"user-agent": "curl/8.0", "Referer": "https://example.com/"}
+		req.QueryString = events.APIGatewayQueryString{"token": {"secret"}, "page": {"2"}}
+		req.Context = getRequestContext()
+		req.Context.SourceIP = "10.0.0.1"
+		return req
+	}
+	ctx := functioncontext.NewContext(context.Background(), &functioncontext.FunctionContext{RequestID: "fn-1"})
+
+	It("Writes Common Log Format lines", func() {
+		out := &bytes.Buffer{}
+		accessor := core.NewRequestAccessor(core.WithAccessLog(core.AccessLogConfig{Writer: out}))
+		_, err := accessor.ServeEventWithContext(ctx, handler, request("/hello"))
+		Expect(err).To(BeNil())
+
+		Expect(out.String()).To(MatchRegexp(`^10\.0\.0\.1 - - \[[^\]]+\] "GET /hello\?page=2&token=secret HTTP/1\.1" 200 5 "x" "fn-1" \d+\.\d{3}\n$`))
+	})
+
+	It("Writes Combined Log Format lines with redacted fields", func() {
+		out := &bytes.Buffer{}
+		accessor := core.NewRequestAccessor(core.WithAccessLog(core.AccessLogConfig{
+			Format:            core.AccessLogCombined,
+			Writer:            out,
+			RedactFields:      []string{core.AccessLogFieldSourceIP},
+			RedactQueryParams: []string{"token"},
+		}))
+		_, err := accessor.ServeEvent(handler, request("/hello"))
+		Expect(err).To(BeNil())
+
+		line := out.String()
+		Expect(line).To(HavePrefix("[REDACTED] - - ["))
+		Expect(line).To(ContainSubstring(`"GET /hello?page=2&token=%5BREDACTED%5D HTTP/1.1" 200 5 "https://example.com/" "curl/8.0" "x" "-" `))
+	})
+
+	It("Panics on fields that cannot be redacted", func() {
+		for _, field := range []string{core.AccessLogFieldStatus, core.AccessLogFieldBytes, core.AccessLogFieldLatencyMs, "unknown"} {
+			Expect(func() {
+				core.WithAccessLog(core.AccessLogConfig{RedactFields: []string{field}})
+			}).To(Panic(), field)
+		}
+	})
+
+	It("Writes JSON lines", func() {
+		out := &bytes.Buffer{}
+		accessor := core.NewRequestAccessor(core.WithAccessLog(core.AccessLogConfig{Format: core.AccessLogJSON, Writer: out}))
+		_, err := accessor.ServeEventWithContext(ctx, handler, request("/hello"))
+		Expect(err).To(BeNil())
+
+		entry := map[string]interface{}{}
+		Expect(json.Unmarshal(out.Bytes(), &entry)).To(BeNil())
+		Expect(entry[core.AccessLogFieldRequestID]).To(Equal("x"))
+		Expect(entry[core.AccessLogFieldFunctionRequestID]).To(Equal("fn-1"))
+		Expect(entry[core.AccessLogFieldStatus]).To(Equal(200.0))
+		Expect(entry[core.AccessLogFieldBytes]).To(Equal(5.0))
+		Expect(entry[core.AccessLogFieldUserAgent]).To(Equal("curl/8.0"))
+		Expect(entry[core.AccessLogFieldStage]).To(Equal("prod"))
+		Expect(entry).To(HaveKey(core.AccessLogFieldLatencyMs))
+	})
+
+	It("Samples requests but keeps errors", func() {
+		out := &bytes.Buffer{}
+		accessor := core.NewRequestAccessor(core.WithAccessLog(core.AccessLogConfig{
+			Writer:          out,
+			SampleRate:      0.000001,
+			AlwaysLogErrors: true,
+		}))
+		for i := 0; i < 20; i++ {
+			accessor.ServeEvent(handler, request("/hello"))
+		}
+		accessor.ServeEvent(handler, request("/fail"))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(1))
+		Expect(regexp.MustCompile(`" 500 - `).MatchString(lines[0])).To(BeTrue())
+	})
+})
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// BasePathMapping describes a base path that API Gateway adds in front of
+// the routes of the application, for example through a custom domain
+// mapping. Host and Stage restrict the requests the mapping applies to;
+// leave them empty to match any host or stage.
+type BasePathMapping struct {
+	// Host is compared with the Host header of the request, ignoring case
+	// and port.
+	Host string
+	// Stage is compared with the API Gateway stage of the request.
+	Stage string
+	// BasePath is removed from the start of the request path. It only
+	// matches whole path segments: "/api" strips "/api/users" but not
+	// "/apiv2/users".
+	BasePath string
+}
+
+// normalizeBasePath adds the leading slash and removes the trailing one.
+// Blank strings and "/" normalize to the empty string.
+func normalizeBasePath(basePath string) string {
+	if strings.Trim(basePath, " ") == "" {
+		return ""
+	}
+
+	newBasePath := basePath
+	if !strings.HasPrefix(newBasePath, "/") {
+		newBasePath = "/" + newBasePath
+	}
+
+	if strings.HasSuffix(newBasePath, "/") {
+		newBasePath = newBasePath[:len(newBasePath)-1]
+	}
+	return newBasePath
+}
+
+// specificity ranks mappings that name both a host and a stage above the
+// ones that name only one of them, and those above catch-all mappings.
+func (m BasePathMapping) specificity() int {
+	s := 0
+	if m.Host != "" {
+		s += 2
+	}
+	if m.Stage != "" {
+		s++
+	}
+	return s
+}
+
+func (m BasePathMapping) matches(host string, req events.APIGatewayRequest) bool {
+	if m.Stage != "" && m.Stage != req.Context.Stage {
+		return false
+	}
+	if m.Host != "" && !strings.EqualFold(m.Host, host) {
+		return false
+	}
+	return hasPathPrefix(req.Path, m.BasePath)
+}
+
+// hasPathPrefix reports whether path starts with the complete segments of
+// prefix.
+func hasPathPrefix(path string, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+// selectBasePath returns the base path to strip from the request path. The
+// most specific matching mapping wins, ties go to the longest base path.
+func selectBasePath(mappings []BasePathMapping, req events.APIGatewayRequest) string {
+	if len(mappings) == 0 {
+		return ""
+	}
+	host := requestHost(req)
+	var best *BasePathMapping
+	for i := range mappings {
+		m := &mappings[i]
+		if !m.matches(host, req) {
+			continue
+		}
+		if best == nil || m.specificity() > best.specificity() ||
+			(m.specificity() == best.specificity() && len(m.BasePath) > len(best.BasePath)) {
+			best = m
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.BasePath
+}
+
+// requestHost returns the Host header of the event without its port.
+func requestHost(req events.APIGatewayRequest) string {
+	host := eventHeader(req, "Host")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+type basePathKey struct{}
+
+// GetBasePathFromContext returns the base path that was stripped from the
+// request path before routing. Handlers can use it to build absolute links.
+// The boolean is false when no base path was stripped.
+func GetBasePathFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(basePathKey{}).(string)
+	return v, ok && v != ""
+}
+
+// routingPaths returns the paths the event can be routed on, without the
+// base path: the decoded path gin routes, the escaped path echo and chi
+// route when its encoding is not the default one, and the decoded path with
+// its dot segments resolved, as handlers that clean paths see it. The
+// frameworks do not clean paths, so "/admin/../x" is routed under "/admin".
+// Rules matching path prefixes must hold for all three, so that encoded
+// characters and dot segments cannot make them see another path than the
+// router or the handler does. The paths are the same for most requests.
+func routingPaths(c *config, req events.APIGatewayRequest) [3]string {
+	escaped := req.Path
+	if basePath := selectBasePath(c.basePaths, req); basePath != "" {
+		escaped = escaped[len(basePath):]
+	}
+	if !strings.HasPrefix(escaped, "/") {
+		escaped = "/" + escaped
+	}
+	decoded := escaped
+	if d, err := url.PathUnescape(escaped); err == nil {
+		decoded = d
+	}
+	return [3]string{decoded, escaped, path.Clean(decoded)}
+}
+
+// excludedPath reports whether every path the event can be routed on is
+// under one of the prefixes, so that exclusions from a check cannot be
+// reached from another route through encoded characters or dot segments.
+func excludedPath(c *config, req events.APIGatewayRequest, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return false
+	}
+	for _, p := range routingPaths(c, req) {
+		if !underPrefix(p, prefixes) {
+			return false
+		}
+	}
+	return true
+}
+
+func underPrefix(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if hasPathPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
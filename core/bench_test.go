@@ -0,0 +1,97 @@
+package core_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+const benchmarkBody = `{"id":42,"name":"gopher","tags":["serverless","api","go"],"address":{"city":"Guangzhou","zip":"510000"}}`
+
+func benchmarkEvent() events.APIGatewayRequest {
+	return coretest.NewEvent("POST", "/orders/42").
+		Header("Accept", "application/json").
+		Header("Accept-Encoding", "gzip, deflate").
+		Header("Authorization", "Bearer token").
+		Header("Content-Type", "application/json").
+		Header("Host", "api.example.com").
+		Header("User-Agent", "benchmark/1.0").
+		Header("X-Forwarded-Proto", "https").
+		Query("expand", "items").
+		Query("page", "2").
+		Body(benchmarkBody).
+		Build()
+}
+
+var benchmarkHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+})
+
+func BenchmarkEventToRequest(b *testing.B) {
+	accessor := core.NewRequestAccessor()
+	event := benchmarkEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := accessor.EventToRequest(event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProxyEventToHTTPRequest(b *testing.B) {
+	accessor := core.NewRequestAccessor()
+	event := benchmarkEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := accessor.ProxyEventToHTTPRequest(event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetProxyResponse(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := core.NewProxyResponseWriter()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, benchmarkBody)
+		if _, err := w.GetProxyResponse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkServeEvent(b *testing.B) {
+	accessor := core.NewRequestAccessor()
+	event := benchmarkEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resp, err := accessor.ServeEvent(benchmarkHandler, event)
+		if err != nil || !strings.HasPrefix(resp.Body, `{"id":42`) {
+			b.Fatal(resp, err)
+		}
+	}
+}
+
+func BenchmarkServeEventWithContext(b *testing.B) {
+	accessor := core.NewRequestAccessor()
+	event := benchmarkEvent()
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resp, err := accessor.ServeEventWithContext(ctx, benchmarkHandler, event)
+		if err != nil || !strings.HasPrefix(resp.Body, `{"id":42`) {
+			b.Fatal(resp, err)
+		}
+	}
+}
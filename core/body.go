@@ -0,0 +1,142 @@
+package core
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// DefaultMaxDecompressedSize is the size, in bytes, a request body can
+// decompress to when WithRequestDecompression is given no limit.
+const DefaultMaxDecompressedSize = 32 << 20
+
+// WithMaxBodySize refuses requests whose body is larger than limit bytes
+// with 413 Request Entity Too Large, before the framework runs. The size is
+// counted after base64 decoding and, with WithRequestDecompression, after
+// decompression. A limit of zero or less removes the limit.
+func WithMaxBodySize(limit int64) Option {
+	return func(c *config) {
+		c.maxBodySize = limit
+	}
+}
+
+// WithRequestDecompression decompresses the bodies of requests with a gzip
+// or deflate Content-Encoding before the framework runs, removing the
+// Content-Encoding header. Bodies that would decompress to more than
+// maxSize bytes, DefaultMaxDecompressedSize when it is zero or less, are
+// refused with 413 Request Entity Too Large without being decompressed any
+// further, and bodies that cannot be decompressed with 400 Bad Request.
+// Bodies with other encodings are passed on as they are.
+func WithRequestDecompression(maxSize int64) Option {
+	return func(c *config) {
+		if maxSize <= 0 {
+			maxSize = DefaultMaxDecompressedSize
+		}
+		c.maxDecompressedSize = maxSize
+	}
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// prepareBody applies the body size limit and decompression to the event.
+// It returns the decompressed body, nil when the body of the event is used
+// as it is, or the response refusing the event.
+func (c *config) prepareBody(ctx context.Context, req events.APIGatewayRequest) ([]byte, *events.APIGatewayResponse) {
+	if c.maxBodySize <= 0 && c.maxDecompressedSize <= 0 {
+		return nil, nil
+	}
+	encodings := c.decompressibleEncodings(req)
+	if encodings == nil {
+		if c.maxBodySize > 0 && c.eventBodySize(ctx, req) > c.maxBodySize {
+			resp := RequestEntityTooLarge()
+			return nil, &resp
+		}
+		return nil, nil
+	}
+
+	r, err := c.eventBodyReader(ctx, req)
+	if err != nil {
+		resp := BadRequest()
+		return nil, &resp
+	}
+	limit := c.maxDecompressedSize
+	if c.maxBodySize > 0 && c.maxBodySize < limit {
+		limit = c.maxBodySize
+	}
+	body, err := decompressBody(r, encodings, limit)
+	if errors.Is(err, errBodyTooLarge) {
+		resp := RequestEntityTooLarge()
+		return nil, &resp
+	}
+	if err != nil {
+		resp := BadRequest()
+		return nil, &resp
+	}
+	if body == nil {
+		body = []byte{}
+	}
+	return body, nil
+}
+
+// decompressibleEncodings returns the content codings of the event, in the
+// order they were applied, when decompression is enabled and they are all
+// supported.
+func (c *config) decompressibleEncodings(req events.APIGatewayRequest) []string {
+	if c.maxDecompressedSize <= 0 {
+		return nil
+	}
+	var encodings []string
+	for _, encoding := range splitHeaderList(eventHeader(req, "Content-Encoding")) {
+		switch encoding = strings.ToLower(encoding); encoding {
+		case "identity":
+		case "gzip", "x-gzip", "deflate":
+			encodings = append(encodings, encoding)
+		default:
+			return nil
+		}
+	}
+	return encodings
+}
+
+// decompressBody undoes the encodings, last applied first, reading at most
+// limit bytes of decompressed data.
+func decompressBody(r io.ReadSeeker, encodings []string, limit int64) ([]byte, error) {
+	var body []byte
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var dr io.ReadCloser
+		var err error
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			dr, err = gzip.NewReader(r)
+		case "deflate":
+			// deflate is meant to be zlib wrapped, but some clients send
+			// raw deflate data
+			dr, err = zlib.NewReader(r)
+			if errors.Is(err, zlib.ErrHeader) {
+				if _, err = r.Seek(0, io.SeekStart); err == nil {
+					dr = flate.NewReader(r)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(io.LimitReader(dr, limit+1))
+		dr.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > limit {
+			return nil, errBodyTooLarge
+		}
+		r = bytes.NewReader(body)
+	}
+	return body, nil
+}
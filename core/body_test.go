@@ -0,0 +1,126 @@
+package core_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+func compress(encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+var _ = Describe("Request body tests", func() {
+	var received struct {
+		called          bool
+		body            string
+		contentEncoding string
+		contentLength   string
+		base64Header    string
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.called = true
+		received.body = string(body)
+		received.contentEncoding = r.Header.Get("Content-Encoding")
+		received.contentLength = r.Header.Get("Content-Length")
+		received.base64Header = r.Header.Get(core.Base64EncodedHeader)
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(accessor *core.RequestAccessor, req events.APIGatewayRequest) int {
+		received.called = false
+		resp, err := accessor.ServeEvent(handler, req)
+		Expect(err).To(BeNil())
+		Expect(received.called).To(Equal(resp.StatusCode == http.StatusOK))
+		return resp.StatusCode
+	}
+	payload := []byte(`{"items":["` + strings.Repeat("a", 1000) + `"]}`)
+
+	It("Decompresses gzip and deflate bodies", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestDecompression(0))
+		for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+			header := strings.TrimPrefix(encoding, "raw-")
+			req := coretest.NewEvent("POST", "/orders").
+				Header("Content-Encoding", header).
+				Header("Content-Length", "42").
+				BinaryBody(compress(encoding, payload)).
+				Build()
+			Expect(serve(accessor, req)).To(Equal(http.StatusOK), encoding)
+			Expect(received.body).To(Equal(string(payload)), encoding)
+			Expect(received.contentEncoding).To(BeEmpty(), encoding)
+			Expect(received.contentLength).To(Equal("1014"), encoding)
+		}
+	})
+
+	It("Decompresses stacked encodings and binary results", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestDecompression(0))
+		binary := []byte{0x00, 0xff, 0xfe, 0x80}
+		req := coretest.NewEvent("POST", "/upload").
+			Header("Content-Encoding", "deflate, gzip").
+			BinaryBody(compress("gzip", compress("deflate", binary))).
+			Build()
+		Expect(serve(accessor, req)).To(Equal(http.StatusOK))
+		Expect([]byte(received.body)).To(Equal(binary))
+		Expect(received.base64Header).To(BeEmpty())
+	})
+
+	It("Passes other encodings through", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestDecompression(0))
+		req := coretest.NewEvent("POST", "/orders").Header("Content-Encoding", "br").Body("compressed").Build()
+		Expect(serve(accessor, req)).To(Equal(http.StatusOK))
+		Expect(received.body).To(Equal("compressed"))
+		Expect(received.contentEncoding).To(Equal("br"))
+	})
+
+	It("Refuses bodies that decompress over the limit", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestDecompression(1000))
+		bomb := compress("gzip", make([]byte, 10<<20))
+		Expect(len(bomb)).To(BeNumerically("<", 64<<10))
+		req := coretest.NewEvent("POST", "/orders").Header("Content-Encoding", "gzip").BinaryBody(bomb).Build()
+		Expect(serve(accessor, req)).To(Equal(http.StatusRequestEntityTooLarge))
+
+		limited := core.NewRequestAccessor(core.WithRequestDecompression(0), core.WithMaxBodySize(1013))
+		req = coretest.NewEvent("POST", "/orders").Header("Content-Encoding", "gzip").BinaryBody(compress("gzip", payload)).Build()
+		Expect(serve(limited, req)).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+
+	It("Refuses bodies that cannot be decompressed", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestDecompression(0))
+		req := coretest.NewEvent("POST", "/orders").Header("Content-Encoding", "gzip").Body("not gzip").Build()
+		Expect(serve(accessor, req)).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Limits the size of plain and base64 bodies", func() {
+		accessor := core.NewRequestAccessor(core.WithMaxBodySize(4))
+		Expect(serve(accessor, coretest.NewEvent("POST", "/").Body("1234").Build())).To(Equal(http.StatusOK))
+		Expect(serve(accessor, coretest.NewEvent("POST", "/").Body("12345").Build())).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(serve(accessor, coretest.NewEvent("POST", "/").BinaryBody([]byte{0xff, 0, 1, 2}).Build())).To(Equal(http.StatusOK))
+		Expect(serve(accessor, coretest.NewEvent("POST", "/").BinaryBody([]byte{0xff, 0, 1, 2, 3}).Build())).To(Equal(http.StatusRequestEntityTooLarge))
+
+		req := coretest.NewEvent("POST", "/").Header("Content-Encoding", "gzip").BinaryBody(compress("gzip", payload)).Build()
+		Expect(serve(core.NewRequestAccessor(core.WithMaxBodySize(2000)), req)).To(Equal(http.StatusOK))
+		Expect(received.contentEncoding).To(Equal("gzip"))
+	})
+})
@@ -0,0 +1,37 @@
+package coretest
+
+import (
+	"context"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+// DefaultTimeLimit is the time limit of function contexts returned by
+// NewFunctionContext.
+const DefaultTimeLimit = 3 * time.Second
+
+// NewFunctionContext returns a FunctionContext for a test invocation of a
+// function named "test-function" with 128MB of memory and DefaultTimeLimit.
+func NewFunctionContext() *functioncontext.FunctionContext {
+	return &functioncontext.FunctionContext{
+		RequestID:          DefaultRequestID,
+		Namespace:          "default",
+		FunctionName:       "test-function",
+		FunctionVersion:    "$LATEST",
+		MemoryLimitInMb:    128,
+		TimeLimitInMs:      int32(DefaultTimeLimit / time.Millisecond),
+		TencentcloudRegion: "ap-guangzhou",
+	}
+}
+
+// NewContext returns a context carrying fc, as the function runtime passes
+// it to the handler, with a deadline fc.TimeLimitInMs from now. A nil fc is
+// replaced with NewFunctionContext().
+func NewContext(parent context.Context, fc *functioncontext.FunctionContext) (context.Context, context.CancelFunc) {
+	if fc == nil {
+		fc = NewFunctionContext()
+	}
+	ctx := functioncontext.NewContext(parent, fc)
+	return context.WithTimeout(ctx, time.Duration(fc.TimeLimitInMs)*time.Millisecond)
+}
@@ -0,0 +1,13 @@
+package coretest_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCoretest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Coretest Suite")
+}
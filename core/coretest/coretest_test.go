@@ -0,0 +1,163 @@
+package coretest_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+var _ = Describe("Coretest tests", func() {
+	Context("Event builder", func() {
+		It("Builds events", func() {
+			event := coretest.NewEvent("post", "/orders").
+				Header("X-Custom", "value").
+				Query("tag", "a", "b").
+				Query("flag").
+				JSONBody(map[string]int{"id": 1}).
+				Stage("prod").
+				SourceIP("10.0.0.1").
+				RequestID("req-1").
+				ServiceID("service-1").
+				Build()
+
+			Expect(event.Method).To(Equal("POST"))
+			Expect(event.Path).To(Equal("/orders"))
+			Expect(event.Headers).To(HaveKeyWithValue("X-Custom", "value"))
+			Expect(event.Headers).To(HaveKeyWithValue("Content-Type", "application/json"))
+			Expect(event.QueryString["tag"]).To(Equal([]string{"a", "b"}))
+			Expect(event.QueryString["flag"]).To(Equal([]string{""}))
+			Expect(event.Body).To(MatchJSON(`{"id":1}`))
+			Expect(event.Context).To(Equal(events.APIGatewayRequestContext{
+				ServiceID: "service-1",
+				RequestID: "req-1",
+				Method:    "POST",
+				Path:      "/orders",
+				SourceIP:  "10.0.0.1",
+				Stage:     "prod",
+			}))
+		})
+
+		It("Builds binary events EventToRequest decodes", func() {
+			binary := []byte{0x00, 0xff, 0xfe}
+			event := coretest.NewEvent("PUT", "/upload").BinaryBody(binary).Build()
+			Expect(event.Body).To(Equal(base64.StdEncoding.EncodeToString(binary)))
+
+			req, err := (&core.RequestAccessor{}).EventToRequest(event)
+			Expect(err).To(BeNil())
+			body, err := io.ReadAll(req.Body)
+			Expect(err).To(BeNil())
+			Expect(body).To(Equal(binary))
+		})
+
+		It("Builds events signed with a key pair", func() {
+			event := coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDexample", "secret").SecretID("AKIDexample").Build()
+			Expect(*event.Context.Identity.SecretID).To(Equal("AKIDexample"))
+			Expect(event.Headers).To(HaveKeyWithValue("Source", "coretest"))
+			Expect(event.Headers["Authorization"]).To(Equal(
+				core.KeyPairAuthorization("AKIDexample", "secret", event.Headers["X-Date"], "coretest")))
+
+			date, err := http.ParseTime(event.Headers["X-Date"])
+			Expect(err).To(BeNil())
+			Expect(date).To(BeTemporally("~", time.Now(), 2*time.Second))
+		})
+
+		It("Does not share state between built events", func() {
+			builder := coretest.NewEvent("GET", "/").Header("A", "1").Query("q", "1")
+			first := builder.Build()
+			builder.Header("A", "2").Query("q", "2")
+
+			Expect(first.Headers["A"]).To(Equal("1"))
+			Expect(first.QueryString["q"]).To(Equal([]string{"1"}))
+		})
+	})
+
+	Context("Function context", func() {
+		It("Carries the function context with a deadline", func() {
+			fc := coretest.NewFunctionContext()
+			fc.TimeLimitInMs = 500
+			ctx, cancel := coretest.NewContext(context.Background(), fc)
+			defer cancel()
+
+			got, ok := functioncontext.FromContext(ctx)
+			Expect(ok).To(BeTrue())
+			Expect(got.FunctionName).To(Equal("test-function"))
+
+			deadline, ok := ctx.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(deadline).To(BeTemporally("~", time.Now().Add(500*time.Millisecond), 100*time.Millisecond))
+		})
+
+		It("Uses a default function context", func() {
+			ctx, cancel := coretest.NewContext(context.Background(), nil)
+			defer cancel()
+
+			got, ok := functioncontext.FromContext(ctx)
+			Expect(ok).To(BeTrue())
+			Expect(got.TimeLimitInMs).To(Equal(int32(3000)))
+		})
+	})
+
+	Context("Response matchers", func() {
+		resp := events.APIGatewayResponse{
+			StatusCode: http.StatusOK,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       `{"id": 1, "name": "a"}`,
+		}
+
+		It("Matches status, headers and bodies", func() {
+			Expect(resp).To(coretest.HaveStatus(200))
+			Expect(&resp).To(coretest.HaveStatus(200))
+			Expect(resp).ToNot(coretest.HaveStatus(404))
+			Expect(resp).To(coretest.HaveHeader("content-type", "application/json"))
+			Expect(resp).To(coretest.HaveHeader("Content-Type", ContainSubstring("json")))
+			Expect(resp).To(coretest.HaveJSONBody(`{"name":"a","id":1}`))
+			Expect(resp).To(coretest.HaveJSONBody(map[string]interface{}{"id": 1, "name": "a"}))
+			Expect(resp).To(coretest.HaveBody(ContainSubstring(`"name"`)))
+		})
+
+		It("Decodes base64 bodies", func() {
+			binary := []byte{0x00, 0xff}
+			encoded := events.APIGatewayResponse{
+				StatusCode:      http.StatusOK,
+				Body:            base64.StdEncoding.EncodeToString(binary),
+				IsBase64Encoded: true,
+			}
+			Expect(encoded).To(coretest.HaveBody(binary))
+		})
+
+		It("Reports missing headers and wrong types", func() {
+			_, err := coretest.HaveHeader("X-Missing", "a").Match(resp)
+			Expect(err).ToNot(BeNil())
+			_, err = coretest.HaveStatus(200).Match("not a response")
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("Describes the failing field", func() {
+			matcher := coretest.HaveStatus(404)
+			Expect(matcher.FailureMessage(resp)).To(ContainSubstring("status code"))
+		})
+	})
+})
+
+func TestAssertResponse(t *testing.T) {
+	resp := events.APIGatewayResponse{
+		StatusCode: http.StatusCreated,
+		Headers:    map[string]string{"Location": "/orders/1"},
+		Body:       `{"id":1}`,
+	}
+	coretest.AssertResponse(t, resp,
+		coretest.HaveStatus(http.StatusCreated),
+		coretest.HaveHeader("Location", "/orders/1"),
+		coretest.HaveJSONBody(`{"id":1}`),
+	)
+}
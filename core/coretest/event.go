@@ -0,0 +1,158 @@
+// Package coretest provides helpers to test handlers served through the
+// adapters: a builder for API Gateway events, a fake function context and
+// Gomega matchers for proxied responses.
+//
+// The matchers work with Ginkgo and Gomega directly, and with the standard
+// testing package through AssertResponse:
+//
+//	event := coretest.NewEvent("POST", "/orders").JSONBody(order).Build()
+//	resp, err := adapter.Proxy(event)
+//	coretest.AssertResponse(t, resp, coretest.HaveStatus(201))
+package coretest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// DefaultRequestID is the gateway request ID of built events unless
+// RequestID is called.
+const DefaultRequestID = "coretest-request"
+
+// DefaultSourceIP is the source IP of built events unless SourceIP is called.
+const DefaultSourceIP = "127.0.0.1"
+
+// EventBuilder builds events.APIGatewayRequest values. The zero value is not
+// usable, create builders with NewEvent.
+type EventBuilder struct {
+	event events.APIGatewayRequest
+}
+
+// NewEvent returns a builder for an event with the given method and path.
+// The request context is filled with the method, path, DefaultRequestID,
+// DefaultSourceIP and core.DefaultStage.
+func NewEvent(method, path string) *EventBuilder {
+	method = strings.ToUpper(method)
+	return &EventBuilder{
+		event: events.APIGatewayRequest{
+			Method:  method,
+			Path:    path,
+			Headers: map[string]string{},
+			Context: events.APIGatewayRequestContext{
+				Method:    method,
+				Path:      path,
+				RequestID: DefaultRequestID,
+				SourceIP:  DefaultSourceIP,
+				Stage:     core.DefaultStage,
+			},
+		},
+	}
+}
+
+// Header sets a header of the event.
+func (b *EventBuilder) Header(name, value string) *EventBuilder {
+	b.event.Headers[name] = value
+	return b
+}
+
+// Query adds values to a query string parameter of the event.
+func (b *EventBuilder) Query(name string, values ...string) *EventBuilder {
+	if b.event.QueryString == nil {
+		b.event.QueryString = events.APIGatewayQueryString{}
+	}
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	b.event.QueryString[name] = append(b.event.QueryString[name], values...)
+	return b
+}
+
+// Body sets the body of the event.
+func (b *EventBuilder) Body(body string) *EventBuilder {
+	b.event.Body = body
+	delete(b.event.Headers, core.Base64EncodedHeader)
+	return b
+}
+
+// JSONBody sets the body of the event to the JSON encoding of v and the
+// Content-Type header to application/json. It panics if v cannot be
+// encoded.
+func (b *EventBuilder) JSONBody(v interface{}) *EventBuilder {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic("coretest: could not encode JSON body: " + err.Error())
+	}
+	b.Header("Content-Type", "application/json")
+	return b.Body(string(body))
+}
+
+// BinaryBody sets the body of the event to the base64 encoding of body,
+// with core.SetBinaryEventBody, so the adapters of the test process decode
+// it.
+func (b *EventBuilder) BinaryBody(body []byte) *EventBuilder {
+	core.SetBinaryEventBody(&b.event, body)
+	return b
+}
+
+// Stage sets the API Gateway stage of the event.
+func (b *EventBuilder) Stage(stage string) *EventBuilder {
+	b.event.Context.Stage = stage
+	return b
+}
+
+// SourceIP sets the client IP of the event.
+func (b *EventBuilder) SourceIP(ip string) *EventBuilder {
+	b.event.Context.SourceIP = ip
+	return b
+}
+
+// RequestID sets the gateway request ID of the event.
+func (b *EventBuilder) RequestID(id string) *EventBuilder {
+	b.event.Context.RequestID = id
+	return b
+}
+
+// ServiceID sets the API Gateway service ID of the event.
+func (b *EventBuilder) ServiceID(id string) *EventBuilder {
+	b.event.Context.ServiceID = id
+	return b
+}
+
+// SecretID sets the secret ID of the identity API Gateway verified, as for
+// APIs with key pair authentication.
+func (b *EventBuilder) SecretID(id string) *EventBuilder {
+	b.event.Context.Identity.SecretID = &id
+	return b
+}
+
+// SignKeyPair signs the event as an API Gateway client does with a key pair,
+// setting the X-Date, Source and Authorization headers. The date is the
+// current time.
+func (b *EventBuilder) SignKeyPair(secretID, secretKey string) *EventBuilder {
+	date := time.Now().UTC().Format(http.TimeFormat)
+	b.Header("X-Date", date)
+	b.Header("Source", "coretest")
+	return b.Header("Authorization", core.KeyPairAuthorization(secretID, secretKey, date, "coretest"))
+}
+
+// Build returns the event. The builder can keep being used, later calls do
+// not change events already built.
+func (b *EventBuilder) Build() events.APIGatewayRequest {
+	event := b.event
+	event.Headers = make(map[string]string, len(b.event.Headers))
+	for k, v := range b.event.Headers {
+		event.Headers[k] = v
+	}
+	if b.event.QueryString != nil {
+		event.QueryString = make(events.APIGatewayQueryString, len(b.event.QueryString))
+		for k, v := range b.event.QueryString {
+			event.QueryString[k] = append([]string(nil), v...)
+		}
+	}
+	return event
+}
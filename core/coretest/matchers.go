@@ -0,0 +1,157 @@
+package coretest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// AssertResponse checks resp against the matchers and fails t for each one
+// that does not match.
+func AssertResponse(t types.GomegaTestingT, resp events.APIGatewayResponse, matchers ...types.GomegaMatcher) {
+	g := gomega.NewWithT(t)
+	for _, matcher := range matchers {
+		g.Expect(resp).To(matcher)
+	}
+}
+
+// HaveStatus succeeds if the response has the status code.
+func HaveStatus(code int) types.GomegaMatcher {
+	return &responseMatcher{
+		field:   "status code",
+		matcher: gomega.Equal(code),
+		extract: func(resp events.APIGatewayResponse) (interface{}, error) {
+			return resp.StatusCode, nil
+		},
+	}
+}
+
+// HaveHeader succeeds if the response has the header, looked up case
+// insensitively, with the value. The value can be a string or a matcher.
+func HaveHeader(name string, value interface{}) types.GomegaMatcher {
+	return &responseMatcher{
+		field:   fmt.Sprintf("header %q", name),
+		matcher: toMatcher(value),
+		extract: func(resp events.APIGatewayResponse) (interface{}, error) {
+			for k, v := range resp.Headers {
+				if strings.EqualFold(k, name) {
+					return v, nil
+				}
+			}
+			return nil, fmt.Errorf("response has no header %q", name)
+		},
+	}
+}
+
+// HaveBody succeeds if the decoded body of the response is the expected
+// value. The value can be a string, a byte slice or a matcher, which
+// receives the body as a string.
+func HaveBody(expected interface{}) types.GomegaMatcher {
+	if b, ok := expected.([]byte); ok {
+		expected = string(b)
+	}
+	return &responseMatcher{
+		field:   "body",
+		matcher: toMatcher(expected),
+		extract: func(resp events.APIGatewayResponse) (interface{}, error) {
+			body, err := decodeBody(resp)
+			return string(body), err
+		},
+	}
+}
+
+// HaveJSONBody succeeds if the decoded body of the response is JSON
+// equivalent to expected. Strings and byte slices are taken as JSON
+// documents, other values are encoded first.
+func HaveJSONBody(expected interface{}) types.GomegaMatcher {
+	switch expected.(type) {
+	case string, []byte:
+	default:
+		b, err := json.Marshal(expected)
+		if err != nil {
+			panic("coretest: could not encode expected JSON body: " + err.Error())
+		}
+		expected = b
+	}
+	return &responseMatcher{
+		field:   "JSON body",
+		matcher: gomega.MatchJSON(expected),
+		extract: func(resp events.APIGatewayResponse) (interface{}, error) {
+			return decodeBody(resp)
+		},
+	}
+}
+
+// responseMatcher applies matcher to the part of the response returned by
+// extract.
+type responseMatcher struct {
+	field   string
+	matcher types.GomegaMatcher
+	extract func(events.APIGatewayResponse) (interface{}, error)
+}
+
+func (m *responseMatcher) Match(actual interface{}) (bool, error) {
+	var resp events.APIGatewayResponse
+	switch r := actual.(type) {
+	case events.APIGatewayResponse:
+		resp = r
+	case *events.APIGatewayResponse:
+		if r == nil {
+			return false, fmt.Errorf("expected an events.APIGatewayResponse, got nil")
+		}
+		resp = *r
+	default:
+		return false, fmt.Errorf("expected an events.APIGatewayResponse, got\n%s", format.Object(actual, 1))
+	}
+	value, err := m.extract(resp)
+	if err != nil {
+		return false, err
+	}
+	return m.matcher.Match(value)
+}
+
+func (m *responseMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("unexpected response %s: %s", m.field, m.matcher.FailureMessage(m.value(actual)))
+}
+
+func (m *responseMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("unexpected response %s: %s", m.field, m.matcher.NegatedFailureMessage(m.value(actual)))
+}
+
+func (m *responseMatcher) value(actual interface{}) interface{} {
+	switch r := actual.(type) {
+	case events.APIGatewayResponse:
+		v, _ := m.extract(r)
+		return v
+	case *events.APIGatewayResponse:
+		if r != nil {
+			v, _ := m.extract(*r)
+			return v
+		}
+	}
+	return actual
+}
+
+func toMatcher(expected interface{}) types.GomegaMatcher {
+	if matcher, ok := expected.(types.GomegaMatcher); ok {
+		return matcher
+	}
+	return gomega.Equal(expected)
+}
+
+func decodeBody(resp events.APIGatewayResponse) ([]byte, error) {
+	if !resp.IsBase64Encoded {
+		return []byte(resp.Body), nil
+	}
+	body, err := base64.StdEncoding.DecodeString(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode base64 body: %w", err)
+	}
+	return body, nil
+}
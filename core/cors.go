@@ -0,0 +1,261 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// DefaultCORSMethods are the methods allowed by WithCORS when the policy
+// does not list any.
+var DefaultCORSMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// CORSConfig is the cross-origin resource sharing policy applied by
+// WithCORS.
+type CORSConfig struct {
+	// AllowOrigins lists the origins allowed to call the API. An entry can
+	// be "*" for any origin, an exact origin such as "https://example.com",
+	// or contain a single wildcard such as "https://*.example.com".
+	AllowOrigins []string
+	// AllowMethods lists the methods allowed in preflight requests.
+	// DefaultCORSMethods are used when it is empty.
+	AllowMethods []string
+	// AllowHeaders lists the request headers allowed in preflight requests.
+	// When it is empty, or contains "*", the requested headers are allowed.
+	AllowHeaders []string
+	// ExposeHeaders lists the response headers readable by the client.
+	ExposeHeaders []string
+	// AllowCredentials lets the client send cookies and credentials. The
+	// request origin is echoed instead of "*", as browsers require, so the
+	// allowed origins must be listed: it cannot be combined with "*".
+	AllowCredentials bool
+	// MaxAge is how long the client can cache a preflight response. No
+	// Access-Control-Max-Age header is sent when it is zero.
+	MaxAge time.Duration
+}
+
+// CORS response and preflight request headers.
+const (
+	headerOrigin                        = "Origin"
+	headerVary                          = "Vary"
+	headerAccessControlRequestMethod    = "Access-Control-Request-Method"
+	headerAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	headerAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	headerAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	headerAccessControlMaxAge           = "Access-Control-Max-Age"
+	accessControlPrefix                 = "Access-Control-"
+)
+
+type corsPolicy struct {
+	anyOrigin     bool
+	origins       []string
+	methods       []string
+	anyHeader     bool
+	headers       []string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+// WithCORS applies a CORS policy to every response, including the error
+// responses generated by the library, replacing any CORS headers set by the
+// handler. Preflight requests, OPTIONS requests with an Origin and an
+// Access-Control-Request-Method header, are answered directly with 204 No
+// Content, or 403 Forbidden when the policy does not allow them, without
+// calling the framework.
+//
+// WithCORS panics if AllowCredentials is combined with the "*" origin, which
+// would let any site make credentialed requests to the API.
+func WithCORS(cors CORSConfig) Option {
+	if cors.AllowCredentials {
+		for _, origin := range cors.AllowOrigins {
+			if origin == "*" {
+				panic(`core: WithCORS cannot allow credentials from the "*" origin`)
+			}
+		}
+	}
+	return func(c *config) {
+		p := &corsPolicy{
+			credentials:   cors.AllowCredentials,
+			exposeHeaders: strings.Join(cors.ExposeHeaders, ", "),
+		}
+		for _, origin := range cors.AllowOrigins {
+			if origin == "*" {
+				p.anyOrigin = true
+				continue
+			}
+			p.origins = append(p.origins, strings.ToLower(strings.TrimSuffix(origin, "/")))
+		}
+		p.methods = cors.AllowMethods
+		if len(p.methods) == 0 {
+			p.methods = DefaultCORSMethods
+		}
+		p.anyHeader = len(cors.AllowHeaders) == 0
+		for _, h := range cors.AllowHeaders {
+			if h == "*" {
+				p.anyHeader = true
+			}
+			p.headers = append(p.headers, http.CanonicalHeaderKey(h))
+		}
+		if cors.MaxAge > 0 {
+			p.maxAge = strconv.Itoa(int(cors.MaxAge / time.Second))
+		}
+		c.cors = p
+	}
+}
+
+// isPreflight reports whether the event is a CORS preflight request.
+func (p *corsPolicy) isPreflight(req events.APIGatewayRequest) bool {
+	return strings.EqualFold(req.Method, http.MethodOptions) &&
+		eventHeader(req, headerOrigin) != "" &&
+		eventHeader(req, headerAccessControlRequestMethod) != ""
+}
+
+// preflight answers a preflight request.
+func (p *corsPolicy) preflight(req events.APIGatewayRequest) events.APIGatewayResponse {
+	resp := events.APIGatewayResponse{StatusCode: http.StatusNoContent, Headers: map[string]string{}}
+	p.vary(&resp, headerOrigin, headerAccessControlRequestMethod, headerAccessControlRequestHeaders)
+
+	origin := eventHeader(req, headerOrigin)
+	method := strings.ToUpper(strings.TrimSpace(eventHeader(req, headerAccessControlRequestMethod)))
+	requested := splitHeaderList(eventHeader(req, headerAccessControlRequestHeaders))
+	if !p.allowOrigin(origin) || !p.allowMethod(method) || !p.allowHeaders(requested) {
+		resp.StatusCode = http.StatusForbidden
+		return resp
+	}
+
+	p.setOrigin(&resp, origin)
+	resp.Headers[headerAccessControlAllowMethods] = strings.Join(p.methods, ", ")
+	if len(requested) > 0 {
+		if p.anyHeader {
+			resp.Headers[headerAccessControlAllowHeaders] = strings.Join(requested, ", ")
+		} else {
+			resp.Headers[headerAccessControlAllowHeaders] = strings.Join(p.headers, ", ")
+		}
+	}
+	if p.maxAge != "" {
+		resp.Headers[headerAccessControlMaxAge] = p.maxAge
+	}
+	return resp
+}
+
+// decorate adds the CORS headers to a response that is not a preflight,
+// after removing the ones set by the handler.
+func (p *corsPolicy) decorate(req events.APIGatewayRequest, resp *events.APIGatewayResponse) {
+	for k := range resp.Headers {
+		if len(k) > len(accessControlPrefix) && strings.EqualFold(k[:len(accessControlPrefix)], accessControlPrefix) {
+			delete(resp.Headers, k)
+		}
+	}
+	if !p.anyOrigin || p.credentials {
+		p.vary(resp, headerOrigin)
+	}
+	origin := eventHeader(req, headerOrigin)
+	if origin == "" || !p.allowOrigin(origin) {
+		return
+	}
+	p.setOrigin(resp, origin)
+	if p.exposeHeaders != "" {
+		setResponseHeader(resp, headerAccessControlExposeHeaders, p.exposeHeaders)
+	}
+}
+
+func (p *corsPolicy) setOrigin(resp *events.APIGatewayResponse, origin string) {
+	if p.anyOrigin && !p.credentials {
+		setResponseHeader(resp, headerAccessControlAllowOrigin, "*")
+	} else {
+		setResponseHeader(resp, headerAccessControlAllowOrigin, origin)
+	}
+	if p.credentials {
+		setResponseHeader(resp, headerAccessControlAllowCredentials, "true")
+	}
+}
+
+// vary adds names to the Vary header of the response, keeping the values
+// already there.
+func (p *corsPolicy) vary(resp *events.APIGatewayResponse, names ...string) {
+	current, _ := responseHeader(*resp, headerVary)
+	values := splitHeaderList(current)
+	for _, name := range names {
+		if !containsFold(values, name) {
+			values = append(values, name)
+		}
+	}
+	setResponseHeader(resp, headerVary, strings.Join(values, ", "))
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.origins {
+		if matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	return containsFold(p.methods, method)
+}
+
+func (p *corsPolicy) allowHeaders(requested []string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, h := range requested {
+		if !containsFold(p.headers, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchOrigin matches a lowercase origin against an allowed origin that can
+// contain one wildcard. The wildcard matches at least one character.
+func matchOrigin(allowed, origin string) bool {
+	star := strings.IndexByte(allowed, '*')
+	if star < 0 {
+		return allowed == origin
+	}
+	prefix, suffix := allowed[:star], allowed[star+1:]
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+// splitHeaderList splits a comma separated header value, dropping empty
+// elements.
+func splitHeaderList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
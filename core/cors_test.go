@@ -0,0 +1,126 @@
+package core_test
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CORS tests", func() {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Header().Set("Access-Control-Allow-Origin", "https://handler.example")
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Write([]byte("ok"))
+	})
+	policy := core.CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		AllowMethods:     []string{"GET", "POST"},
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	preflight := func(origin, method, headers string) *coretest.EventBuilder {
+		return coretest.NewEvent("OPTIONS", "/orders").
+			Header("Origin", origin).
+			Header("Access-Control-Request-Method", method).
+			Header("Access-Control-Request-Headers", headers)
+	}
+
+	BeforeEach(func() {
+		called = false
+	})
+
+	It("Answers allowed preflights without calling the handler", func() {
+		accessor := core.NewRequestAccessor(core.WithCORS(policy))
+		resp, err := accessor.ServeEvent(handler, preflight("https://api.example.org", "post", "content-type").Build())
+		Expect(err).To(BeNil())
+		Expect(called).To(BeFalse())
+		Expect(resp).To(coretest.HaveStatus(http.StatusNoContent))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Origin", "https://api.example.org"))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Methods", "GET, POST"))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Headers", "Content-Type, Authorization"))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Credentials", "true"))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Max-Age", "600"))
+		Expect(resp).To(coretest.HaveHeader("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers"))
+	})
+
+	It("Forbids preflights the policy does not allow", func() {
+		accessor := core.NewRequestAccessor(core.WithCORS(policy))
+		for _, event := range []*coretest.EventBuilder{
+			preflight("https://evil.example", "GET", ""),
+			preflight("https://example.org", "GET", ""),
+			preflight("https://app.example.com", "DELETE", ""),
+			preflight("https://app.example.com", "GET", "X-Secret"),
+		} {
+			resp, err := accessor.ServeEvent(handler, event.Build())
+			Expect(err).To(BeNil())
+			Expect(resp).To(coretest.HaveStatus(http.StatusForbidden))
+			Expect(resp.Headers).ToNot(HaveKey("Access-Control-Allow-Origin"))
+		}
+		Expect(called).To(BeFalse())
+	})
+
+	It("Sends plain OPTIONS requests to the handler", func() {
+		accessor := core.NewRequestAccessor(core.WithCORS(policy))
+		_, err := accessor.ServeEvent(handler, coretest.NewEvent("OPTIONS", "/orders").Header("Origin", "https://app.example.com").Build())
+		Expect(err).To(BeNil())
+		Expect(called).To(BeTrue())
+	})
+
+	It("Decorates handler responses", func() {
+		accessor := core.NewRequestAccessor(core.WithCORS(policy))
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", "/orders").Header("origin", "https://APP.example.com").Build())
+		Expect(err).To(BeNil())
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Origin", "https://APP.example.com"))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Credentials", "true"))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Expose-Headers", "X-Request-Id"))
+		Expect(resp).To(coretest.HaveHeader("Vary", "Accept-Encoding, Origin"))
+	})
+
+	It("Removes handler CORS headers for disallowed origins", func() {
+		accessor := core.NewRequestAccessor(core.WithCORS(policy))
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", "/orders").Header("Origin", "https://evil.example").Build())
+		Expect(err).To(BeNil())
+		Expect(resp.Headers).ToNot(HaveKey("Access-Control-Allow-Origin"))
+		Expect(resp).To(coretest.HaveHeader("Vary", "Accept-Encoding, Origin"))
+	})
+
+	It("Decorates library error responses", func() {
+		accessor := core.NewRequestAccessor(core.WithCORS(policy))
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("BAD METHOD", "/orders").Header("Origin", "https://app.example.com").Build())
+		Expect(err).ToNot(BeNil())
+		Expect(resp).To(coretest.HaveStatus(http.StatusGatewayTimeout))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Origin", "https://app.example.com"))
+	})
+
+	It("Allows any origin with a wildcard", func() {
+		accessor := core.NewRequestAccessor(core.WithCORS(core.CORSConfig{AllowOrigins: []string{"*"}}))
+		resp, err := accessor.ServeEvent(handler, preflight("https://any.example", "PATCH", "X-Custom").Build())
+		Expect(err).To(BeNil())
+		Expect(resp).To(coretest.HaveStatus(http.StatusNoContent))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Origin", "*"))
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Headers", "X-Custom"))
+		Expect(resp.Headers).ToNot(HaveKey("Access-Control-Allow-Credentials"))
+
+		resp, err = accessor.ServeEvent(handler, coretest.NewEvent("GET", "/").Header("Origin", "https://any.example").Build())
+		Expect(err).To(BeNil())
+		Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Origin", "*"))
+		Expect(resp).To(coretest.HaveHeader("Vary", "Accept-Encoding"))
+	})
+
+	It("Refuses credentials for any origin", func() {
+		Expect(func() {
+			core.WithCORS(core.CORSConfig{AllowOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true})
+		}).To(Panic())
+		Expect(func() {
+			core.WithCORS(core.CORSConfig{AllowOrigins: []string{"https://*.example.org"}, AllowCredentials: true})
+		}).ToNot(Panic())
+	})
+})
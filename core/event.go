@@ -0,0 +1,240 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// Base64EncodedHeader marks events whose body is base64 encoded.
+// RequestToEvent and SetBinaryEventBody set it for binary bodies, with a
+// value only the process that built the event knows, and EventToRequest
+// decodes the body of the events they marked. API Gateway does not set the
+// header; it passes it on like any other header a client sends, so the
+// value "true" is ignored unless the accessor is created with
+// WithBase64Header. EventToRequest always removes the header.
+const Base64EncodedHeader = "X-GoLambdaProxy-Base64-Encoded"
+
+// base64Mark is the value of Base64EncodedHeader in the events built by
+// this process, which clients cannot guess.
+var base64Mark = "true; " + newRequestID()
+
+// WithBase64Header decodes the body of every event whose
+// Base64EncodedHeader is "true", for functions invoked directly with events
+// built by RequestToEvent in another process, as clientdemo does. Any
+// client can send the header through API Gateway, so only use it for
+// functions API Gateway does not reach, or whose callers are all trusted.
+func WithBase64Header() Option {
+	return func(c *config) {
+		c.base64Header = true
+	}
+}
+
+// DefaultStage is the API Gateway stage used by RequestToEvent when the
+// request does not carry one in the X-Apigateway-Stage header.
+const DefaultStage = "release"
+
+// RequestToEvent converts an http.Request into the events.APIGatewayRequest
+// API Gateway would send for it. All headers are kept, multi-value headers
+// joined with commas, as are all query string values. Bodies that are not
+// valid UTF-8 are set with SetBinaryEventBody. The
+// request context gets the method, path, source IP and stage of the request
+// and a random request ID. The X-Apigateway-* headers EventToRequest adds are
+// moved back into the request context instead.
+// The request body is read and replaced with an equivalent reader.
+// The result converts back to an equivalent request with EventToRequest.
+func RequestToEvent(req *http.Request) (events.APIGatewayRequest, error) {
+	event := events.APIGatewayRequest{
+		Headers: map[string]string{},
+		Method:  strings.ToUpper(req.Method),
+		Path:    req.URL.EscapedPath(),
+	}
+	if event.Method == "" {
+		event.Method = http.MethodGet
+	}
+	if event.Path == "" {
+		event.Path = "/"
+	}
+
+	gateway := gatewayHeaders(req.Header)
+	for k, v := range req.Header {
+		if _, ok := gateway[http.CanonicalHeaderKey(k)]; ok {
+			continue
+		}
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(Base64EncodedHeader) {
+			continue
+		}
+		if http.CanonicalHeaderKey(k) == "X-Forwarded-For" {
+			v = trimForwardedFor(v, gateway["X-Apigateway-Sourceip"])
+		}
+		if len(v) > 0 {
+			event.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+	if req.Host != "" {
+		event.Headers["Host"] = req.Host
+	}
+
+	query := req.URL.Query()
+	if len(query) > 0 {
+		event.QueryString = make(events.APIGatewayQueryString, len(query))
+		for k, v := range query {
+			event.QueryString[k] = v
+		}
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return events.APIGatewayRequest{}, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if utf8.Valid(body) {
+			event.Body = string(body)
+		} else {
+			SetBinaryEventBody(&event, body)
+		}
+	}
+
+	event.Context = events.APIGatewayRequestContext{
+		ServiceID: gateway["X-Apigateway-Serviceid"],
+		RequestID: gateway["X-Apigateway-Requestid"],
+		Method:    gateway["X-Apigateway-Method"],
+		Path:      gateway["X-Apigateway-Path"],
+		SourceIP:  gateway["X-Apigateway-Sourceip"],
+		Stage:     gateway["X-Apigateway-Stage"],
+	}
+	if event.Context.Method == "" {
+		event.Context.Method = event.Method
+	}
+	if event.Context.Path == "" {
+		event.Context.Path = event.Path
+	}
+	if event.Context.RequestID == "" {
+		event.Context.RequestID = newRequestID()
+	}
+	if event.Context.SourceIP == "" {
+		event.Context.SourceIP = remoteIP(req.RemoteAddr)
+	}
+	if event.Context.Stage == "" {
+		event.Context.Stage = DefaultStage
+	}
+	return event, nil
+}
+
+// gatewayHeaders returns the X-Apigateway-* headers EventToRequest adds for
+// the request context, keyed by their canonical name.
+func gatewayHeaders(header http.Header) map[string]string {
+	gateway := map[string]string{}
+	for _, k := range []string{
+		"X-Apigateway-Serviceid",
+		"X-Apigateway-Requestid",
+		"X-Apigateway-Method",
+		"X-Apigateway-Path",
+		"X-Apigateway-Sourceip",
+		"X-Apigateway-Stage",
+	} {
+		if v, ok := header[k]; ok {
+			gateway[k] = strings.Join(v, ", ")
+		}
+	}
+	return gateway
+}
+
+// trimForwardedFor removes the source IP EventToRequest appends to the
+// X-Forwarded-For header.
+func trimForwardedFor(values []string, sourceIP string) []string {
+	if n := len(values); sourceIP != "" && n > 0 && values[n-1] == sourceIP {
+		return values[:n-1]
+	}
+	return values
+}
+
+// SetBinaryEventBody sets the body of the event to the base64 encoding of
+// body and marks it with Base64EncodedHeader, so EventToRequest decodes it
+// in this process.
+func SetBinaryEventBody(event *events.APIGatewayRequest, body []byte) {
+	if event.Headers == nil {
+		event.Headers = map[string]string{}
+	}
+	for k := range event.Headers {
+		if strings.EqualFold(k, Base64EncodedHeader) {
+			delete(event.Headers, k)
+		}
+	}
+	event.Body = base64.StdEncoding.EncodeToString(body)
+	event.Headers[Base64EncodedHeader] = base64Mark
+}
+
+// base64Event reports whether the body of the event is base64 encoded: the
+// event was marked by this process or, with WithBase64Header, by its sender.
+func (c *config) base64Event(req events.APIGatewayRequest) bool {
+	v := eventHeader(req, Base64EncodedHeader)
+	if v == base64Mark {
+		return true
+	}
+	if !c.base64Header {
+		return false
+	}
+	v, _, _ = strings.Cut(v, ";")
+	return strings.EqualFold(strings.TrimSpace(v), "true")
+}
+
+// eventBodyReader returns a reader for the body of the event, decoding it
+// when it is base64 encoded. Plain bodies are read in place, without
+// copying them out of the event.
+func (c *config) eventBodyReader(ctx context.Context, req events.APIGatewayRequest) (io.ReadSeeker, error) {
+	if !c.base64Event(req) {
+		return strings.NewReader(req.Body), nil
+	}
+	body, err := decodeEventBody(ctx, req)
+	return bytes.NewReader(body), err
+}
+
+// eventBodySize returns the size of the event body once base64 decoded, or
+// zero when it cannot be decoded.
+func (c *config) eventBodySize(ctx context.Context, req events.APIGatewayRequest) int64 {
+	if !c.base64Event(req) {
+		return int64(len(req.Body))
+	}
+	body, _ := decodeEventBody(ctx, req)
+	return int64(len(body))
+}
+
+// decodeEventBody base64 decodes the body of the event, once per
+// invocation: the size checks, the metrics and the request share the
+// result.
+func decodeEventBody(ctx context.Context, req events.APIGatewayRequest) ([]byte, error) {
+	inv := invocationFromContext(ctx)
+	if inv != nil && inv.decoded != nil {
+		return inv.decoded, nil
+	}
+	body, err := base64.StdEncoding.DecodeString(req.Body)
+	if err == nil && inv != nil {
+		inv.decoded = body
+	}
+	return body, err
+}
+
+func remoteIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
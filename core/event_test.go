@@ -0,0 +1,141 @@
+package core_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestToEvent tests", func() {
+	accessor := core.RequestAccessor{}
+
+	It("Converts method, path, headers and query", func() {
+		req := httptest.NewRequest("post", "http://example.com/orders/a%2Fb?tag=1&tag=2&empty=", strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Add("Accept", "text/plain")
+		req.Header.Add("Accept", "application/json")
+		req.RemoteAddr = "10.0.0.1:4321"
+
+		event, err := core.RequestToEvent(req)
+		Expect(err).To(BeNil())
+		Expect(event.Method).To(Equal("POST"))
+		Expect(event.Path).To(Equal("/orders/a%2Fb"))
+		Expect(event.Body).To(Equal(`{"a":1}`))
+		Expect(event.Headers["Content-Type"]).To(Equal("application/json"))
+		Expect(event.Headers["Accept"]).To(Equal("text/plain, application/json"))
+		Expect(event.Headers["Host"]).To(Equal("example.com"))
+		Expect(event.QueryString["tag"]).To(Equal([]string{"1", "2"}))
+		Expect(event.QueryString["empty"]).To(Equal([]string{""}))
+
+		Expect(event.Context.Method).To(Equal("POST"))
+		Expect(event.Context.Path).To(Equal("/orders/a%2Fb"))
+		Expect(event.Context.SourceIP).To(Equal("10.0.0.1"))
+		Expect(event.Context.Stage).To(Equal(core.DefaultStage))
+		Expect(event.Context.RequestID).ToNot(BeEmpty())
+
+		body, err := io.ReadAll(req.Body)
+		Expect(err).To(BeNil())
+		Expect(string(body)).To(Equal(`{"a":1}`))
+	})
+
+	It("Base64 encodes binary bodies", func() {
+		binary := []byte{0xff, 0xfe, 0x00, 0x01}
+		req := httptest.NewRequest("PUT", "/upload", bytes.NewReader(binary))
+
+		event, err := core.RequestToEvent(req)
+		Expect(err).To(BeNil())
+		Expect(event.Body).To(Equal(base64.StdEncoding.EncodeToString(binary)))
+		Expect(event.Headers[core.Base64EncodedHeader]).ToNot(BeEmpty())
+		Expect(event.Headers[core.Base64EncodedHeader]).ToNot(Equal("true"))
+	})
+
+	It("Does not trust the base64 header of clients", func() {
+		event := coretest.NewEvent("POST", "/hello").Build()
+		event.Headers = map[string]string{core.Base64EncodedHeader: "true"}
+		event.Body = base64.StdEncoding.EncodeToString([]byte("hello"))
+
+		httpReq, err := accessor.EventToRequest(event)
+		Expect(err).To(BeNil())
+		Expect(httpReq.Header.Get(core.Base64EncodedHeader)).To(BeEmpty())
+		body, err := io.ReadAll(httpReq.Body)
+		Expect(err).To(BeNil())
+		Expect(string(body)).To(Equal(event.Body))
+
+		req := httptest.NewRequest("POST", "/upload", strings.NewReader("plain"))
+		req.Header.Set(core.Base64EncodedHeader, "true")
+		converted, err := core.RequestToEvent(req)
+		Expect(err).To(BeNil())
+		Expect(converted.Headers).ToNot(HaveKey(core.Base64EncodedHeader))
+	})
+
+	It("Decodes base64 headers from trusted senders with WithBase64Header", func() {
+		event := coretest.NewEvent("POST", "/hello").Build()
+		event.Headers = map[string]string{core.Base64EncodedHeader: "true"}
+		event.Body = base64.StdEncoding.EncodeToString([]byte("hello"))
+
+		httpReq, err := core.NewRequestAccessor(core.WithBase64Header()).EventToRequest(event)
+		Expect(err).To(BeNil())
+		Expect(httpReq.Header.Get(core.Base64EncodedHeader)).To(BeEmpty())
+		body, err := io.ReadAll(httpReq.Body)
+		Expect(err).To(BeNil())
+		Expect(string(body)).To(Equal("hello"))
+	})
+
+	It("Keeps gateway context set by EventToRequest", func() {
+		original := coretest.NewEvent("GET", "/hello").Build()
+		original.Context = getRequestContext()
+		original.Context.SourceIP = "192.168.0.1"
+		original.Headers = map[string]string{"X-Forwarded-For": "10.0.0.1"}
+		httpReq, err := accessor.EventToRequest(original)
+		Expect(err).To(BeNil())
+
+		event, err := core.RequestToEvent(httpReq)
+		Expect(err).To(BeNil())
+		Expect(event.Context.RequestID).To(Equal("x"))
+		Expect(event.Context.ServiceID).To(Equal("x"))
+		Expect(event.Context.Stage).To(Equal("prod"))
+		Expect(event.Context.SourceIP).To(Equal("192.168.0.1"))
+		Expect(event.Headers).ToNot(HaveKey("X-Apigateway-Requestid"))
+		Expect(event.Headers["X-Forwarded-For"]).To(Equal("10.0.0.1"))
+	})
+
+	It("Round trips through EventToRequest", func() {
+		binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+		req := httptest.NewRequest("PATCH", "/files/a%20b?x=1&x=2&y=%3D", bytes.NewReader(binary))
+		req.Header.Set("Content-Type", "image/png")
+		req.Header.Set("X-Custom", "value")
+
+		event, err := core.RequestToEvent(req)
+		Expect(err).To(BeNil())
+
+		httpReq, err := accessor.EventToRequest(event)
+		Expect(err).To(BeNil())
+		Expect(httpReq.Method).To(Equal(http.MethodPatch))
+		Expect(httpReq.URL.Path).To(Equal("/files/a b"))
+		Expect(httpReq.URL.Query()).To(Equal(req.URL.Query()))
+		Expect(httpReq.Header.Get("Content-Type")).To(Equal("image/png"))
+		Expect(httpReq.Header.Get("X-Custom")).To(Equal("value"))
+		Expect(httpReq.Header.Get(core.Base64EncodedHeader)).To(BeEmpty())
+
+		body, err := io.ReadAll(httpReq.Body)
+		Expect(err).To(BeNil())
+		Expect(body).To(Equal(binary))
+	})
+
+	It("Rejects events with invalid base64 bodies", func() {
+		event := coretest.NewEvent("POST", "/hello").Build()
+		core.SetBinaryEventBody(&event, []byte{0xff})
+		event.Body = "not base64!"
+
+		_, err := accessor.EventToRequest(event)
+		Expect(err).ToNot(BeNil())
+	})
+})
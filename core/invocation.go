@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// warm is set after the first invocation served by this instance.
+var warm atomic.Bool
+
+// invocation holds the state of a single proxied event. It is created by
+// the proxy pipeline and travels in the request context, so that handlers
+// and adapters can report back information such as the matched route.
+type invocation struct {
+	coldStart     bool
+	wantsRoute    bool
+	route         string
+	responseBytes int
+	initDuration  time.Duration
+	// body is the request body prepared by prepareBody, nil when the body
+	// of the event is used as it is
+	body []byte
+	// decoded is the base64 decoded body of the event, once decoded
+	decoded []byte
+}
+
+type invocationKey struct{}
+
+func newInvocation() *invocation {
+	return &invocation{coldStart: !warm.Swap(true)}
+}
+
+func withInvocation(ctx context.Context, inv *invocation) context.Context {
+	return context.WithValue(ctx, invocationKey{}, inv)
+}
+
+func invocationFromContext(ctx context.Context) *invocation {
+	inv, _ := ctx.Value(invocationKey{}).(*invocation)
+	return inv
+}
+
+// preparedBody returns the request body prepared for the invocation, nil
+// when there is none.
+func preparedBody(ctx context.Context) []byte {
+	if inv := invocationFromContext(ctx); inv != nil {
+		return inv.body
+	}
+	return nil
+}
+
+// WantsRoute reports whether the route template of the request is used,
+// for traces, metrics or access logs. The adapters only look the route up
+// when it is, as it can cost a second match of the request.
+func WantsRoute(req *http.Request) bool {
+	inv := invocationFromContext(req.Context())
+	return inv != nil && inv.wantsRoute
+}
+
+// SetRoute records the route template that matched the request, for
+// example "/users/:id". The adapters call it once the framework has routed
+// the request; the template is used to name spans and to group metrics.
+// It does nothing when the request was not created by the proxy pipeline.
+func SetRoute(req *http.Request, route string) {
+	if inv := invocationFromContext(req.Context()); inv != nil {
+		inv.route = route
+	}
+}
+
+// GetRouteFromContext returns the route template recorded with SetRoute.
+// The adapters only record it when WantsRoute reports true.
+func GetRouteFromContext(ctx context.Context) (string, bool) {
+	inv := invocationFromContext(ctx)
+	if inv == nil || inv.route == "" {
+		return "", false
+	}
+	return inv.route, true
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+// InvocationInfo describes the function invocation serving a request, from
+// the FunctionContext the runtime passes to the function.
+type InvocationInfo struct {
+	// RequestID is the request ID of the function invocation, not to be
+	// confused with the API Gateway request ID.
+	RequestID       string
+	Namespace       string
+	FunctionName    string
+	FunctionVersion string
+	Region          string
+	MemoryLimitInMB int
+	// Timeout is the time limit of the function.
+	Timeout time.Duration
+	// Deadline is when the invocation times out, the zero time when the
+	// context has no deadline.
+	Deadline time.Time
+}
+
+// RemainingTime returns the time left before the invocation times out, zero
+// once the deadline has passed, and false when there is no deadline.
+func (i InvocationInfo) RemainingTime() (time.Duration, bool) {
+	if i.Deadline.IsZero() {
+		return 0, false
+	}
+	remaining := time.Until(i.Deadline)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, true
+}
+
+// GetInvocationInfo retrieve the InvocationInfo of the invocation serving
+// the request
+func GetInvocationInfo(req *http.Request) (InvocationInfo, bool) {
+	return GetInvocationInfoFromContext(req.Context())
+}
+
+// GetInvocationInfoFromContext retrieve the InvocationInfo from
+// context.Context. It returns false when the context carries no
+// FunctionContext. The function name, version and memory limit fall back
+// to the environment of the instance when the FunctionContext lacks them.
+func GetInvocationInfoFromContext(ctx context.Context) (InvocationInfo, bool) {
+	fc, _ := GetRuntimeContextFromContext(ctx)
+	if fc == nil {
+		fc, _ = functioncontext.FromContext(ctx)
+	}
+	if fc == nil {
+		return InvocationInfo{}, false
+	}
+	info := InvocationInfo{
+		RequestID:       fc.RequestID,
+		Namespace:       fc.Namespace,
+		FunctionName:    fc.FunctionName,
+		FunctionVersion: fc.FunctionVersion,
+		Region:          fc.TencentcloudRegion,
+		MemoryLimitInMB: int(fc.MemoryLimitInMb),
+		Timeout:         time.Duration(fc.TimeLimitInMs) * time.Millisecond,
+	}
+	if info.FunctionName == "" {
+		info.FunctionName = functioncontext.FunctionName
+	}
+	if info.FunctionVersion == "" {
+		info.FunctionVersion = functioncontext.FunctionVersion
+	}
+	if info.MemoryLimitInMB == 0 {
+		info.MemoryLimitInMB = functioncontext.MemoryLimitInMB
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		info.Deadline = deadline
+	}
+	return info, true
+}
@@ -0,0 +1,75 @@
+package core_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+var _ = Describe("Invocation info tests", func() {
+	var info core.InvocationInfo
+	var found bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, found = core.GetInvocationInfo(r)
+		w.WriteHeader(http.StatusOK)
+	})
+	accessor := core.NewRequestAccessor()
+
+	It("Reads the function context of the invocation", func() {
+		ctx, cancel := coretest.NewContext(context.Background(), nil)
+		defer cancel()
+		_, err := accessor.ServeEventWithContext(ctx, handler, coretest.NewEvent("GET", "/").Build())
+		Expect(err).To(BeNil())
+
+		Expect(found).To(BeTrue())
+		deadline, _ := ctx.Deadline()
+		Expect(info).To(Equal(core.InvocationInfo{
+			RequestID:       coretest.DefaultRequestID,
+			Namespace:       "default",
+			FunctionName:    "test-function",
+			FunctionVersion: "$LATEST",
+			Region:          "ap-guangzhou",
+			MemoryLimitInMB: 128,
+			Timeout:         coretest.DefaultTimeLimit,
+			Deadline:        deadline,
+		}))
+		remaining, ok := info.RemainingTime()
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(BeNumerically("~", coretest.DefaultTimeLimit, time.Second))
+	})
+
+	It("Falls back to the environment of the instance", func() {
+		defer func(name, version string, memory int) {
+			functioncontext.FunctionName, functioncontext.FunctionVersion, functioncontext.MemoryLimitInMB = name, version, memory
+		}(functioncontext.FunctionName, functioncontext.FunctionVersion, functioncontext.MemoryLimitInMB)
+		functioncontext.FunctionName, functioncontext.FunctionVersion, functioncontext.MemoryLimitInMB = "env-function", "3", 256
+
+		ctx := functioncontext.NewContext(context.Background(), &functioncontext.FunctionContext{RequestID: "req-1"})
+		info, ok := core.GetInvocationInfoFromContext(ctx)
+		Expect(ok).To(BeTrue())
+		Expect(info.RequestID).To(Equal("req-1"))
+		Expect(info.FunctionName).To(Equal("env-function"))
+		Expect(info.FunctionVersion).To(Equal("3"))
+		Expect(info.MemoryLimitInMB).To(Equal(256))
+
+		_, ok = info.RemainingTime()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Reports expired and missing invocations", func() {
+		expired := core.InvocationInfo{Deadline: time.Now().Add(-time.Second)}
+		remaining, ok := expired.RemainingTime()
+		Expect(ok).To(BeTrue())
+		Expect(remaining).To(BeZero())
+
+		_, err := accessor.ServeEventWithContext(context.Background(), handler, coretest.NewEvent("GET", "/").Build())
+		Expect(err).To(BeNil())
+		Expect(found).To(BeFalse())
+	})
+})
@@ -0,0 +1,86 @@
+package core_test
+
+import (
+	"net/http"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IP filter tests", func() {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(r.Header.Get("X-Apigateway-Sourceip")))
+	})
+	accessor := core.NewRequestAccessor(
+		core.WithBasePath("/api"),
+		core.WithIPFilter(
+			core.IPRule{Deny: []string{"203.0.113.7"}},
+			core.IPRule{PathPrefix: "/admin", Allow: []string{"10.0.0.0/8", "2001:db8::/32"}},
+			core.IPRule{PathPrefix: "/admin/health"},
+		),
+	)
+	serve := func(path, sourceIP string) int {
+		called = false
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", path).SourceIP(sourceIP).Build())
+		Expect(err).To(BeNil())
+		Expect(called).To(Equal(resp.StatusCode != http.StatusForbidden))
+		return resp.StatusCode
+	}
+
+	It("Allows listed addresses on filtered paths", func() {
+		Expect(serve("/api/admin/users", "10.1.2.3")).To(Equal(http.StatusOK))
+		Expect(serve("/api/admin", "2001:db8::1")).To(Equal(http.StatusOK))
+		Expect(serve("/api/admin", "::ffff:10.0.0.1")).To(Equal(http.StatusOK))
+	})
+
+	It("Refuses other addresses before the handler runs", func() {
+		Expect(serve("/api/admin/users", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin", "2001:db9::1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin", "")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin", "not an ip")).To(Equal(http.StatusForbidden))
+	})
+
+	It("Applies the most specific rule", func() {
+		Expect(serve("/api/admin/health", "192.168.1.1")).To(Equal(http.StatusOK))
+		Expect(serve("/api/administrator", "192.168.1.1")).To(Equal(http.StatusOK))
+		Expect(serve("/api/orders", "203.0.113.7")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/orders", "not an ip")).To(Equal(http.StatusOK))
+	})
+
+	It("Matches the path the framework routes on", func() {
+		Expect(serve("/api/%61dmin/users", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin/../orders", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin/%2e%2e/orders", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin%2F..%2Forders", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin/health/../../admin/users", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/orders/../admin", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/orders/%2e%2e/admin", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api//admin", "192.168.1.1")).To(Equal(http.StatusForbidden))
+		Expect(serve("/api/admin/health/status", "192.168.1.1")).To(Equal(http.StatusOK))
+	})
+
+	It("Ignores source IP headers sent by the client", func() {
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", "/api/admin").
+			SourceIP("192.168.1.1").
+			Header("X-Apigateway-Sourceip", "10.0.0.1").
+			Build())
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+
+		resp, err = accessor.ServeEvent(handler, coretest.NewEvent("GET", "/api/orders").
+			SourceIP("192.168.1.1").
+			Header("x-apigateway-sourceip", "10.0.0.1").
+			Build())
+		Expect(err).To(BeNil())
+		Expect(resp.Body).To(Equal("192.168.1.1"))
+	})
+
+	It("Panics on invalid addresses", func() {
+		Expect(func() { core.WithIPFilter(core.IPRule{Allow: []string{"10.0.0.0/33"}}) }).To(Panic())
+		Expect(func() { core.WithIPFilter(core.IPRule{Deny: []string{"example.com"}}) }).To(Panic())
+	})
+})
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// JWTKey is a key verifying token signatures: a []byte secret for HS256, an
+// *rsa.PublicKey for RS256 or an *ecdsa.PublicKey on P-256 for ES256.
+type JWTKey struct {
+	// ID is matched against the kid header of the tokens. A key without ID
+	// is tried for every token.
+	ID string
+	// Algorithm restricts the key to one algorithm, when it is set.
+	Algorithm string
+	Key       interface{}
+}
+
+// JWTKeySource returns the keys that can verify a token. Errors are
+// reported as a failure to load the keys, not as an invalid token.
+type JWTKeySource interface {
+	// JWTKeys returns the keys matching the kid header of a token, which
+	// can be empty.
+	JWTKeys(ctx context.Context, kid string) ([]JWTKey, error)
+}
+
+type staticJWTKeys []JWTKey
+
+// StaticJWTKeys returns a JWTKeySource with a fixed set of keys.
+func StaticJWTKeys(keys ...JWTKey) JWTKeySource {
+	return staticJWTKeys(keys)
+}
+
+func (s staticJWTKeys) JWTKeys(ctx context.Context, kid string) ([]JWTKey, error) {
+	return matchJWTKeys(s, kid), nil
+}
+
+// matchJWTKeys returns the keys with the ID, and the keys without ID.
+func matchJWTKeys(keys []JWTKey, kid string) []JWTKey {
+	var matched []JWTKey
+	for _, key := range keys {
+		if key.ID == "" || key.ID == kid {
+			matched = append(matched, key)
+		}
+	}
+	return matched
+}
+
+// ParseJWKS parses a JSON Web Key Set. RSA keys, EC keys on P-256 and
+// symmetric keys are returned; encryption keys and other key types are
+// skipped.
+func ParseJWKS(b []byte) ([]JWTKey, error) {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := make([]JWTKey, 0, len(set.Keys))
+	for _, raw := range set.Keys {
+		key, ok, err := parseJWK(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS: %w", err)
+		}
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	K         string `json:"k"`
+}
+
+func parseJWK(raw json.RawMessage) (JWTKey, bool, error) {
+	var k jwk
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return JWTKey{}, false, err
+	}
+	if k.Use != "" && k.Use != "sig" {
+		return JWTKey{}, false, nil
+	}
+	key := JWTKey{ID: k.KeyID, Algorithm: k.Algorithm}
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return JWTKey{}, false, fmt.Errorf("key %q: n: %w", k.KeyID, err)
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return JWTKey{}, false, fmt.Errorf("key %q: invalid exponent", k.KeyID)
+		}
+		key.Key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		if k.Curve != "P-256" {
+			return JWTKey{}, false, nil
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return JWTKey{}, false, fmt.Errorf("key %q: x: %w", k.KeyID, err)
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return JWTKey{}, false, fmt.Errorf("key %q: y: %w", k.KeyID, err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return JWTKey{}, false, fmt.Errorf("key %q: point not on curve", k.KeyID)
+		}
+		key.Key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return JWTKey{}, false, fmt.Errorf("key %q: invalid k", k.KeyID)
+		}
+		key.Key = secret
+	default:
+		return JWTKey{}, false, nil
+	}
+	return key, true, nil
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWKSFile returns a JWTKeySource reading a JSON Web Key Set from a file.
+// The file is read when the first token is verified, and read again after
+// a failure.
+func JWKSFile(path string) JWTKeySource {
+	return &jwksFile{path: path}
+}
+
+type jwksFile struct {
+	path string
+	mu   sync.Mutex
+	keys []JWTKey
+}
+
+func (f *jwksFile) JWTKeys(ctx context.Context, kid string) ([]JWTKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.keys == nil {
+		b, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := ParseJWKS(b)
+		if err != nil {
+			return nil, err
+		}
+		f.keys = keys
+	}
+	return matchJWTKeys(f.keys, kid), nil
+}
+
+// DefaultJWKSRefreshInterval is how long JWKSURL keeps a key set before
+// fetching it again.
+const DefaultJWKSRefreshInterval = time.Hour
+
+// jwksMinRefreshInterval limits the fetches triggered by tokens with an
+// unknown kid or by a failing key server, so a client cannot make the proxy
+// hammer the key server.
+const jwksMinRefreshInterval = time.Minute
+
+// JWKSURL returns a JWTKeySource fetching a JSON Web Key Set over HTTP. The
+// set is fetched when the first token is verified and again after
+// DefaultJWKSRefreshInterval, or earlier when a token has an unknown kid,
+// to pick up rotated keys. When a fetch fails the previous set is kept, and
+// the set is not fetched again for a minute.
+func JWKSURL(url string) JWTKeySource {
+	return &jwksURL{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type jwksURL struct {
+	url    string
+	client *http.Client
+
+	mu   sync.Mutex
+	keys []JWTKey
+	// fetched is when the keys were fetched, attempted when the last fetch
+	// started, whether it succeeded or not.
+	fetched   time.Time
+	attempted time.Time
+	// refreshing is closed when the fetch in progress completes, and is nil
+	// when no fetch is in progress. err is the error of the last fetch.
+	refreshing chan struct{}
+	err        error
+}
+
+// JWTKeys fetches the set outside the lock, so a slow key server only holds
+// up the tokens that need the new keys. Concurrent fetches are merged into
+// one; while it runs, tokens with a known kid are verified with the
+// previous set.
+func (u *jwksURL) JWTKeys(ctx context.Context, kid string) ([]JWTKey, error) {
+	u.mu.Lock()
+	now := time.Now()
+	retry := now.Sub(u.attempted) >= jwksMinRefreshInterval
+	stale := (u.keys == nil || now.Sub(u.fetched) >= DefaultJWKSRefreshInterval) && retry
+	unknown := kid != "" && !hasJWTKeyID(u.keys, kid) && retry
+	if !stale && !unknown {
+		defer u.mu.Unlock()
+		if u.keys == nil {
+			return nil, u.err
+		}
+		return matchJWTKeys(u.keys, kid), nil
+	}
+	if done := u.refreshing; done != nil {
+		if u.keys != nil && !unknown {
+			defer u.mu.Unlock()
+			return matchJWTKeys(u.keys, kid), nil
+		}
+		u.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if u.keys == nil {
+			return nil, u.err
+		}
+		return matchJWTKeys(u.keys, kid), nil
+	}
+	done := make(chan struct{})
+	u.refreshing = done
+	u.mu.Unlock()
+
+	keys, err := u.fetch(ctx)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.refreshing, u.attempted, u.err = nil, now, err
+	close(done)
+	switch {
+	case err == nil:
+		u.keys, u.fetched = keys, now
+	case u.keys == nil:
+		return nil, err
+	default:
+		log.Printf("Could not refresh the JWKS, keeping the previous keys: %v\n", err)
+	}
+	return matchJWTKeys(u.keys, kid), nil
+}
+
+func (u *jwksURL) fetch(ctx context.Context) ([]JWTKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", u.url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+func hasJWTKeyID(keys []JWTKey, kid string) bool {
+	for _, key := range keys {
+		if key.ID == kid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,383 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// JWT signing algorithms supported by WithJWTAuth.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+)
+
+// JWTConfig configures WithJWTAuth.
+type JWTConfig struct {
+	// Keys verifies the token signatures. It is required.
+	Keys JWTKeySource
+	// Algorithms lists the signing algorithms accepted, all the supported
+	// ones when it is empty.
+	Algorithms []string
+	// Issuer is the iss claim tokens must have, when it is set.
+	Issuer string
+	// Audience lists the aud claims accepted, when it is not empty. The
+	// token must have at least one of them.
+	Audience []string
+	// Cookie is the name of a cookie holding the token, read when the
+	// request has no Authorization header.
+	Cookie string
+	// Leeway is the clock skew allowed when checking exp and nbf.
+	Leeway time.Duration
+	// Exclude lists the path prefixes served without a token, such as a
+	// health check.
+	Exclude []string
+}
+
+// JWTClaims are the claims of a verified token. The registered claims are
+// decoded in the fields, all the claims are in Raw.
+type JWTClaims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	// Raw holds every claim of the token, with numbers as json.Number.
+	Raw map[string]interface{}
+
+	payload []byte
+}
+
+// Decode unmarshals the claims into v, for example a struct with the
+// private claims of the application.
+func (c *JWTClaims) Decode(v interface{}) error {
+	return json.Unmarshal(c.payload, v)
+}
+
+type jwtAuth struct {
+	keys       JWTKeySource
+	algorithms []string
+	issuer     string
+	audience   []string
+	cookie     string
+	leeway     time.Duration
+	exclude    []string
+}
+
+// WithJWTAuth requires a valid JSON Web Token on every request, signed with
+// HS256, RS256 or ES256, before the framework runs. The token is read from
+// an "Authorization: Bearer" header, or from a cookie when the config names
+// one and the request has no bearer token. With WithKeySignature, which
+// takes the Authorization header for the key signature, the token must come
+// from the cookie. Requests without a valid token get 401 Unauthorized with a
+// WWW-Authenticate header; when the keys cannot be loaded they get 503
+// Service Unavailable and the proxy returns the error.
+//
+// The exp and nbf claims are checked when the token has them, iss and aud
+// when the config sets them. The verified claims are stored in the request
+// context, read them with GetJWTClaimsFromContext. CORS preflights and the
+// excluded paths are not authenticated. A path is only excluded when its
+// decoded, escaped and cleaned forms all are, so "/admin/../health" is
+// authenticated even when "/health" is excluded.
+//
+// WithJWTAuth panics if the config has no keys or an unsupported algorithm.
+func WithJWTAuth(cfg JWTConfig) Option {
+	if cfg.Keys == nil {
+		panic("core: WithJWTAuth requires keys")
+	}
+	a := &jwtAuth{
+		keys:       cfg.Keys,
+		algorithms: cfg.Algorithms,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		cookie:     cfg.Cookie,
+		leeway:     cfg.Leeway,
+	}
+	if len(a.algorithms) == 0 {
+		a.algorithms = []string{JWTAlgorithmHS256, JWTAlgorithmRS256, JWTAlgorithmES256}
+	}
+	for _, alg := range a.algorithms {
+		if alg != JWTAlgorithmHS256 && alg != JWTAlgorithmRS256 && alg != JWTAlgorithmES256 {
+			panic(fmt.Sprintf("core: unsupported JWT algorithm %q", alg))
+		}
+	}
+	for _, prefix := range cfg.Exclude {
+		a.exclude = append(a.exclude, normalizeBasePath(prefix))
+	}
+	return func(c *config) {
+		c.jwtAuth = a
+	}
+}
+
+// errInvalidJWT is wrapped by the errors of tokens that cannot be accepted,
+// as opposed to the errors loading the keys.
+var errInvalidJWT = errors.New("invalid token")
+
+func invalidJWT(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", errInvalidJWT, fmt.Sprintf(format, a...))
+}
+
+// authenticate verifies the token of the event. It returns the response
+// refusing the request, or the claims when the request may go on; both are
+// nil when the path is excluded.
+func (a *jwtAuth) authenticate(ctx context.Context, c *config, req events.APIGatewayRequest) (*JWTClaims, *events.APIGatewayResponse, error) {
+	if excludedPath(c, req, a.exclude) {
+		return nil, nil, nil
+	}
+	token := a.token(req)
+	if token == "" {
+		resp := Unauthorized(`Bearer`)
+		return nil, &resp, nil
+	}
+	claims, err := a.verify(ctx, token, time.Now())
+	if errors.Is(err, errInvalidJWT) {
+		resp := Unauthorized(`Bearer error="invalid_token"`)
+		return nil, &resp, nil
+	}
+	if err != nil {
+		resp := ServiceUnavailable()
+		return nil, &resp, NewLoggedError("Could not load the JWT keys: %v", err)
+	}
+	return claims, nil, nil
+}
+
+// token returns the bearer token of the Authorization header, or the value
+// of the cookie.
+func (a *jwtAuth) token(req events.APIGatewayRequest) string {
+	if authorization := eventHeader(req, "Authorization"); authorization != "" {
+		scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if a.cookie == "" {
+		return ""
+	}
+	header := http.Header{"Cookie": {eventHeader(req, "Cookie")}}
+	cookie, err := (&http.Request{Header: header}).Cookie(a.cookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// verify checks the signature and the claims of a compact serialized token.
+func (a *jwtAuth) verify(ctx context.Context, token string, now time.Time) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidJWT("not a compact JWS")
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, invalidJWT("header: %v", err)
+	}
+	if !a.acceptsAlgorithm(header.Algorithm) {
+		return nil, invalidJWT("algorithm %q not accepted", header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidJWT("signature: %v", err)
+	}
+
+	keys, err := a.keys.JWTKeys(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(token[:len(parts[0])+1+len(parts[1])])
+	verified := false
+	for _, key := range keys {
+		if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+			continue
+		}
+		if verifyJWTSignature(header.Algorithm, key.Key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, invalidJWT("signature does not match any key")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalidJWT("payload: %v", err)
+	}
+	claims, err := parseJWTClaims(payload)
+	if err != nil {
+		return nil, invalidJWT("claims: %v", err)
+	}
+	if err := a.checkClaims(claims, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *jwtAuth) acceptsAlgorithm(alg string) bool {
+	for _, accepted := range a.algorithms {
+		if alg == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *jwtAuth) checkClaims(claims *JWTClaims, now time.Time) error {
+	if !claims.ExpiresAt.IsZero() && !now.Before(claims.ExpiresAt.Add(a.leeway)) {
+		return invalidJWT("token expired")
+	}
+	if !claims.NotBefore.IsZero() && now.Add(a.leeway).Before(claims.NotBefore) {
+		return invalidJWT("token not valid yet")
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return invalidJWT("issuer %q not accepted", claims.Issuer)
+	}
+	if len(a.audience) > 0 {
+		for _, aud := range claims.Audience {
+			for _, accepted := range a.audience {
+				if aud == accepted {
+					return nil
+				}
+			}
+		}
+		return invalidJWT("audience not accepted")
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifyJWTSignature reports whether signature is a valid signature of
+// signed with the key, for the algorithm. Keys of the wrong type for the
+// algorithm never verify.
+func verifyJWTSignature(alg string, key interface{}, signed, signature []byte) bool {
+	switch alg {
+	case JWTAlgorithmHS256:
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case JWTAlgorithmRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case JWTAlgorithmES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	}
+	return false
+}
+
+func parseJWTClaims(payload []byte) (*JWTClaims, error) {
+	claims := &JWTClaims{payload: payload}
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.UseNumber()
+	if err := d.Decode(&claims.Raw); err != nil {
+		return nil, err
+	}
+	if claims.Raw == nil {
+		return nil, errors.New("claims are not an object")
+	}
+
+	var err error
+	texts := map[string]*string{"iss": &claims.Issuer, "sub": &claims.Subject, "jti": &claims.ID}
+	for name, field := range texts {
+		if v, ok := claims.Raw[name]; ok {
+			if *field, ok = v.(string); !ok {
+				return nil, fmt.Errorf("%s is not a string", name)
+			}
+		}
+	}
+	times := map[string]*time.Time{"exp": &claims.ExpiresAt, "nbf": &claims.NotBefore, "iat": &claims.IssuedAt}
+	for name, field := range times {
+		if v, ok := claims.Raw[name]; ok {
+			if *field, err = numericDate(v); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	switch aud := claims.Raw["aud"].(type) {
+	case nil:
+	case string:
+		claims.Audience = []string{aud}
+	case []interface{}:
+		for _, v := range aud {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("aud is not a list of strings")
+			}
+			claims.Audience = append(claims.Audience, s)
+		}
+	default:
+		return nil, errors.New("aud is not a string or a list")
+	}
+	return claims, nil
+}
+
+// numericDate converts a JSON number of seconds since the epoch.
+func numericDate(v interface{}) (time.Time, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, errors.New("not a number")
+	}
+	seconds, err := n.Float64()
+	if err != nil || math.IsInf(seconds, 0) || math.Abs(seconds) > math.MaxInt64/float64(time.Second) {
+		return time.Time{}, errors.New("not a valid date")
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+}
+
+type jwtClaimsKey struct{}
+
+func withJWTClaims(ctx context.Context, claims *JWTClaims) context.Context {
+	return context.WithValue(ctx, jwtClaimsKey{}, claims)
+}
+
+// GetJWTClaimsFromContext retrieve the claims verified by WithJWTAuth from
+// context.Context
+func GetJWTClaimsFromContext(ctx context.Context) (*JWTClaims, bool) {
+	claims, ok := ctx.Value(jwtClaimsKey{}).(*JWTClaims)
+	return claims, ok && claims != nil
+}
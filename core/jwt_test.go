@@ -0,0 +1,316 @@
+package core_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// signJWT returns a compact token with the claims, signed with key for the
+// algorithm.
+func signJWT(alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		Expect(err).To(BeNil())
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		Expect(err).To(BeNil())
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeJWKInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+var _ = Describe("JWT authentication tests", func() {
+	secret := []byte("correct horse battery staple")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeJWKInt(rsaKey.N), "e": encodeJWKInt(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeJWKInt(ecKey.X), "y": encodeJWKInt(ecKey.Y)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+
+	var claims *core.JWTClaims
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = core.GetJWTClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":  "https://issuer.example.com",
+			"sub":  "user-1",
+			"aud":  []string{"other", "orders-api"},
+			"exp":  time.Now().Add(time.Hour).Unix(),
+			"nbf":  time.Now().Add(-time.Minute).Unix(),
+			"role": "admin",
+		}
+	}
+	newAccessor := func(keys core.JWTKeySource) *core.RequestAccessor {
+		return core.NewRequestAccessor(core.WithJWTAuth(core.JWTConfig{
+			Keys:     keys,
+			Issuer:   "https://issuer.example.com",
+			Audience: []string{"orders-api"},
+			Cookie:   "session",
+			Exclude:  []string{"/health"},
+		}))
+	}
+	serve := func(accessor *core.RequestAccessor, req events.APIGatewayRequest) events.APIGatewayResponse {
+		claims = nil
+		resp, err := accessor.ServeEventWithContext(context.Background(), handler, req)
+		Expect(err).To(BeNil())
+		return resp
+	}
+	bearer := func(token string) events.APIGatewayRequest {
+		return coretest.NewEvent("GET", "/orders").Header("Authorization", "Bearer "+token).Build()
+	}
+
+	It("Accepts tokens signed with each algorithm and exposes the claims", func() {
+		accessor := newAccessor(core.StaticJWTKeys(
+			core.JWTKey{Key: secret},
+			core.JWTKey{ID: "rsa", Key: &rsaKey.PublicKey},
+			core.JWTKey{ID: "ec", Key: &ecKey.PublicKey},
+		))
+		for _, token := range []string{
+			signJWT("HS256", "", secret, valid()),
+			signJWT("RS256", "rsa", rsaKey, valid()),
+			signJWT("ES256", "ec", ecKey, valid()),
+		} {
+			Expect(serve(accessor, bearer(token)).StatusCode).To(Equal(http.StatusOK))
+			Expect(claims).ToNot(BeNil())
+			Expect(claims.Subject).To(Equal("user-1"))
+			Expect(claims.Audience).To(Equal([]string{"other", "orders-api"}))
+			Expect(claims.ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), 2*time.Second))
+
+			var custom struct {
+				Role string `json:"role"`
+			}
+			Expect(claims.Decode(&custom)).To(BeNil())
+			Expect(custom.Role).To(Equal("admin"))
+		}
+	})
+
+	It("Refuses missing and invalid tokens", func() {
+		accessor := newAccessor(core.StaticJWTKeys(core.JWTKey{Key: secret}, core.JWTKey{ID: "rsa", Key: &rsaKey.PublicKey}))
+
+		resp := serve(accessor, coretest.NewEvent("GET", "/orders").Build())
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Headers).To(HaveKeyWithValue("WWW-Authenticate", "Bearer"))
+
+		expired := valid()
+		expired["exp"] = time.Now().Add(-time.Minute).Unix()
+		notYet := valid()
+		notYet["nbf"] = time.Now().Add(time.Minute).Unix()
+		wrongIssuer := valid()
+		wrongIssuer["iss"] = "https://evil.example.com"
+		wrongAudience := valid()
+		wrongAudience["aud"] = "billing-api"
+		badAudience := valid()
+		badAudience["aud"] = 42
+
+		for name, token := range map[string]string{
+			"expired":        signJWT("HS256", "", secret, expired),
+			"not yet valid":  signJWT("HS256", "", secret, notYet),
+			"wrong issuer":   signJWT("HS256", "", secret, wrongIssuer),
+			"wrong audience": signJWT("HS256", "", secret, wrongAudience),
+			"bad audience":   signJWT("HS256", "", secret, badAudience),
+			"wrong secret":   signJWT("HS256", "", []byte("wrong"), valid()),
+			"none":           signJWT("none", "", nil, valid()),
+			"wrong key type": signJWT("HS256", "rsa", rsaKey.PublicKey.N.Bytes(), valid()),
+			"unknown kid":    signJWT("RS256", "other", rsaKey, valid()),
+			"malformed":      "not.a.token",
+			"two parts":      "abc.def",
+		} {
+			resp := serve(accessor, bearer(token))
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized), name)
+			Expect(resp.Headers).To(HaveKeyWithValue("WWW-Authenticate", `Bearer error="invalid_token"`), name)
+			Expect(claims).To(BeNil(), name)
+		}
+
+		basic := coretest.NewEvent("GET", "/orders").Header("Authorization", "Basic dXNlcjpwYXNz").Build()
+		Expect(serve(accessor, basic).StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("Honors the leeway", func() {
+		accessor := core.NewRequestAccessor(core.WithJWTAuth(core.JWTConfig{
+			Keys:   core.StaticJWTKeys(core.JWTKey{Key: secret}),
+			Leeway: time.Minute,
+		}))
+		expired := valid()
+		expired["exp"] = time.Now().Add(-10 * time.Second).Unix()
+		Expect(serve(accessor, bearer(signJWT("HS256", "", secret, expired))).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Restricts the algorithms", func() {
+		accessor := core.NewRequestAccessor(core.WithJWTAuth(core.JWTConfig{
+			Keys:       core.StaticJWTKeys(core.JWTKey{Key: secret}, core.JWTKey{Key: &rsaKey.PublicKey}),
+			Algorithms: []string{core.JWTAlgorithmRS256},
+		}))
+		Expect(serve(accessor, bearer(signJWT("RS256", "", rsaKey, valid()))).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(accessor, bearer(signJWT("HS256", "", secret, valid()))).StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(func() {
+			core.WithJWTAuth(core.JWTConfig{Keys: core.StaticJWTKeys(), Algorithms: []string{"none"}})
+		}).To(Panic())
+		Expect(func() { core.WithJWTAuth(core.JWTConfig{}) }).To(Panic())
+	})
+
+	It("Reads the token from the cookie and skips excluded paths", func() {
+		accessor := newAccessor(core.StaticJWTKeys(core.JWTKey{Key: secret}))
+		req := coretest.NewEvent("GET", "/orders").
+			Header("Cookie", "theme=dark; session="+signJWT("HS256", "", secret, valid())).
+			Build()
+		Expect(serve(accessor, req).StatusCode).To(Equal(http.StatusOK))
+		Expect(claims.Issuer).To(Equal("https://issuer.example.com"))
+
+		Expect(serve(accessor, coretest.NewEvent("GET", "/health").Build()).StatusCode).To(Equal(http.StatusOK))
+		Expect(claims).To(BeNil())
+		Expect(serve(accessor, coretest.NewEvent("GET", "/healthz").Build()).StatusCode).To(Equal(http.StatusUnauthorized))
+		for _, path := range []string{"/admin/../health", "/admin/%2e%2e/health", "/health/../admin", "/%68ealth/x"} {
+			Expect(serve(accessor, coretest.NewEvent("GET", path).Build()).StatusCode).To(Equal(http.StatusUnauthorized), path)
+		}
+	})
+
+	It("Loads a JWKS from a file", func() {
+		dir, err := os.MkdirTemp("", "jwks")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "jwks.json")
+		accessor := newAccessor(core.JWKSFile(path))
+		token := signJWT("ES256", "ec", ecKey, valid())
+
+		resp, err := accessor.ServeEvent(handler, bearer(token))
+		Expect(err).ToNot(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		Expect(os.WriteFile(path, jwks, 0o600)).To(BeNil())
+		Expect(serve(accessor, bearer(token)).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(accessor, bearer(signJWT("RS256", "rsa", rsaKey, valid()))).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Loads a JWKS from a URL once", func() {
+		var fetches int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			w.Write(jwks)
+		}))
+		defer server.Close()
+
+		accessor := newAccessor(core.JWKSURL(server.URL))
+		for i := 0; i < 3; i++ {
+			Expect(serve(accessor, bearer(signJWT("RS256", "rsa", rsaKey, valid()))).StatusCode).To(Equal(http.StatusOK))
+		}
+		Expect(serve(accessor, bearer(signJWT("RS256", "unknown", rsaKey, valid()))).StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(atomic.LoadInt32(&fetches)).To(Equal(int32(1)))
+	})
+
+	It("Shares one JWKS fetch between concurrent tokens without blocking them", func() {
+		var fetches int32
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			w.Write(jwks)
+		}))
+		defer server.Close()
+
+		source := core.JWKSURL(server.URL)
+		results := make(chan int, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				keys, _ := source.JWTKeys(context.Background(), "rsa")
+				results <- len(keys)
+			}()
+		}
+		Eventually(func() int32 { return atomic.LoadInt32(&fetches) }).Should(Equal(int32(1)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := source.JWTKeys(ctx, "rsa")
+		Expect(err).To(Equal(context.DeadlineExceeded))
+
+		close(release)
+		for i := 0; i < 3; i++ {
+			Eventually(results).Should(Receive(Equal(1)))
+		}
+		Expect(atomic.LoadInt32(&fetches)).To(Equal(int32(1)))
+	})
+
+	It("Does not refetch a failing JWKS URL for unknown kids", func() {
+		var fetches int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		source := core.JWKSURL(server.URL)
+		for _, kid := range []string{"rsa", "random-1", "random-2", ""} {
+			_, err := source.JWTKeys(context.Background(), kid)
+			Expect(err).ToNot(BeNil(), kid)
+		}
+		Expect(atomic.LoadInt32(&fetches)).To(Equal(int32(1)))
+	})
+
+	It("Parses JWKS documents", func() {
+		keys, err := core.ParseJWKS(jwks)
+		Expect(err).To(BeNil())
+		Expect(keys).To(HaveLen(2))
+		Expect(keys[0].Key).To(Equal(&rsaKey.PublicKey))
+
+		_, err = core.ParseJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+		Expect(err).ToNot(BeNil())
+		_, err = core.ParseJWKS([]byte(`not json`))
+		Expect(err).ToNot(BeNil())
+		keys, err = core.ParseJWKS([]byte(fmt.Sprintf(`{"keys":[{"kty":"oct","k":%q}]}`, base64.RawURLEncoding.EncodeToString(secret))))
+		Expect(err).To(BeNil())
+		Expect(keys).To(Equal([]core.JWTKey{{Key: secret}}))
+	})
+})
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LazyInit builds a value on first use instead of when the function
+// instance starts, for example a framework engine that needs database
+// pools or remote configuration. It is safe for concurrent use: concurrent
+// callers wait for a single build. A failed build is retried on the next
+// call.
+type LazyInit[T any] struct {
+	factory func() (T, error)
+	mu      sync.Mutex
+	value   atomic.Pointer[T]
+}
+
+// NewLazyInit returns a LazyInit that builds its value with factory.
+func NewLazyInit[T any](factory func() (T, error)) *LazyInit[T] {
+	return &LazyInit[T]{factory: factory}
+}
+
+// Get returns the value, building it first if needed. When the build runs
+// as part of a proxied invocation, ctx being its request context, the
+// build time is added to the metrics of that invocation.
+func (l *LazyInit[T]) Get(ctx context.Context) (T, error) {
+	if v := l.value.Load(); v != nil {
+		return *v, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if v := l.value.Load(); v != nil {
+		return *v, nil
+	}
+
+	start := time.Now()
+	v, err := l.factory()
+	elapsed := time.Since(start)
+	if err != nil {
+		log.Printf("Lazy initialization failed after %s: %v\n", elapsed, err)
+		return v, err
+	}
+	log.Printf("Lazy initialization completed in %s\n", elapsed)
+	if inv := invocationFromContext(ctx); inv != nil {
+		inv.initDuration += elapsed
+	}
+	l.value.Store(&v)
+	return v, nil
+}
+
+// NewLazyHandler returns an http.Handler that builds the real handler with
+// factory when the first request arrives. Requests fail with 503 Service
+// Unavailable while the factory returns errors.
+func NewLazyHandler(factory func() (http.Handler, error)) http.Handler {
+	lazy := NewLazyInit(factory)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, err := lazy.Get(r.Context())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// IsColdStart reports whether the request is the first one served by this
+// function instance.
+func IsColdStart(ctx context.Context) bool {
+	inv := invocationFromContext(ctx)
+	return inv != nil && inv.coldStart
+}
@@ -0,0 +1,101 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lazy initialization tests", func() {
+	It("Builds the value once under concurrency", func() {
+		var builds int32
+		lazy := core.NewLazyInit(func() (string, error) {
+			atomic.AddInt32(&builds, 1)
+			time.Sleep(10 * time.Millisecond)
+			return "value", nil
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := lazy.Get(context.Background())
+				Expect(err).To(BeNil())
+				Expect(v).To(Equal("value"))
+			}()
+		}
+		wg.Wait()
+		Expect(atomic.LoadInt32(&builds)).To(Equal(int32(1)))
+	})
+
+	It("Retries failed builds", func() {
+		attempts := 0
+		lazy := core.NewLazyInit(func() (int, error) {
+			attempts++
+			if attempts == 1 {
+				return 0, errors.New("config server unavailable")
+			}
+			return 42, nil
+		})
+
+		_, err := lazy.Get(context.Background())
+		Expect(err).ToNot(BeNil())
+		v, err := lazy.Get(context.Background())
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(42))
+	})
+
+	It("Serves through a lazy handler and records the init duration", func() {
+		fail := true
+		handler := core.NewLazyHandler(func() (http.Handler, error) {
+			if fail {
+				return nil, errors.New("not yet")
+			}
+			time.Sleep(time.Millisecond)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ready"))
+			}), nil
+		})
+		sink := &core.MemoryMetricsSink{}
+		accessor := core.NewRequestAccessor(core.WithMetrics(sink))
+
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", "/").Build())
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		fail = false
+		resp, err = accessor.ServeEvent(handler, coretest.NewEvent("GET", "/").Build())
+		Expect(err).To(BeNil())
+		Expect(resp.Body).To(Equal("ready"))
+		resp, err = accessor.ServeEvent(handler, coretest.NewEvent("GET", "/").Build())
+		Expect(err).To(BeNil())
+
+		metrics := sink.Metrics()
+		Expect(metrics[1].InitDuration).To(BeNumerically(">=", time.Millisecond))
+		Expect(metrics[2].InitDuration).To(BeZero())
+	})
+
+	It("Exposes the cold start flag to handlers", func() {
+		coldStarts := []bool{}
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			coldStarts = append(coldStarts, core.IsColdStart(r.Context()))
+			w.WriteHeader(http.StatusNoContent)
+		})
+		accessor := core.NewRequestAccessor()
+		accessor.ServeEventWithContext(context.Background(), handler, coretest.NewEvent("GET", "/").Build())
+		accessor.ServeEventWithContext(context.Background(), handler, coretest.NewEvent("GET", "/").Build())
+
+		Expect(coldStarts).To(HaveLen(2))
+		Expect(coldStarts[1]).To(BeFalse())
+		Expect(core.IsColdStart(context.Background())).To(BeFalse())
+	})
+})
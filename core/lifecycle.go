@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// DefaultShutdownTimeout bounds the time given to OnShutdown hooks when
+// Hooks.ShutdownTimeout is not set.
+const DefaultShutdownTimeout = 2 * time.Second
+
+// Hooks are called at the points of the lifecycle of a function instance.
+// Every field is optional.
+type Hooks struct {
+	// OnInit runs before the first invocation is served. If it fails the
+	// invocation is answered with 503 Service Unavailable and OnInit runs
+	// again on the next invocation.
+	OnInit func(ctx context.Context) error
+	// BeforeInvoke runs before every invocation, after OnInit succeeded.
+	BeforeInvoke func(ctx context.Context, req events.APIGatewayRequest)
+	// AfterInvoke runs after every invocation, with the response and error
+	// returned to the runtime.
+	AfterInvoke func(ctx context.Context, req events.APIGatewayRequest, resp events.APIGatewayResponse, err error)
+	// OnShutdown runs once, when RequestAccessor.Shutdown is called or, with
+	// HandleShutdownSignals, when the instance receives SIGTERM or SIGINT.
+	// Use it to flush logs and telemetry and to close pools. Its context
+	// expires ShutdownTimeout after the shutdown started.
+	OnShutdown func(ctx context.Context) error
+	// ShutdownTimeout bounds OnShutdown, DefaultShutdownTimeout when zero.
+	// It counts from the start of the shutdown, not from the end of the
+	// hooks run before this one.
+	ShutdownTimeout time.Duration
+}
+
+// WithHooks registers lifecycle hooks. It can be given several times; the
+// hooks run in the order they were given.
+func WithHooks(hooks Hooks) Option {
+	return func(c *config) {
+		if c.lifecycle == nil {
+			c.lifecycle = &lifecycle{}
+		}
+		c.lifecycle.hooks = append(c.lifecycle.hooks, hooks)
+	}
+}
+
+// lifecycle runs the hooks of an accessor. It is created while the
+// options are applied and is shared, never copied, afterwards.
+type lifecycle struct {
+	hooks []Hooks
+
+	initMu      sync.Mutex
+	initialized bool
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+func (l *lifecycle) init(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.initMu.Lock()
+	defer l.initMu.Unlock()
+	if l.initialized {
+		return nil
+	}
+	start := time.Now()
+	for _, h := range l.hooks {
+		if h.OnInit == nil {
+			continue
+		}
+		if err := h.OnInit(ctx); err != nil {
+			return err
+		}
+	}
+	l.initialized = true
+	if inv := invocationFromContext(ctx); inv != nil {
+		inv.initDuration += time.Since(start)
+	}
+	log.Printf("Function instance initialized in %s\n", time.Since(start))
+	return nil
+}
+
+func (l *lifecycle) beforeInvoke(ctx context.Context, req events.APIGatewayRequest) {
+	if l == nil {
+		return
+	}
+	for _, h := range l.hooks {
+		if h.BeforeInvoke != nil {
+			h.BeforeInvoke(ctx, req)
+		}
+	}
+}
+
+func (l *lifecycle) afterInvoke(ctx context.Context, req events.APIGatewayRequest, resp events.APIGatewayResponse, err error) {
+	if l == nil {
+		return
+	}
+	for _, h := range l.hooks {
+		if h.AfterInvoke != nil {
+			h.AfterInvoke(ctx, req, resp, err)
+		}
+	}
+}
+
+// shutdown runs the OnShutdown hooks once, in order. Every hook is bounded
+// by ctx and by its timeout counted from the start of the shutdown, so the
+// hooks share one deadline instead of adding up their timeouts.
+func (l *lifecycle) shutdown(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.shutdownOnce.Do(func() {
+		start := time.Now()
+		var errs []error
+		for _, h := range l.hooks {
+			if h.OnShutdown == nil {
+				continue
+			}
+			timeout := h.ShutdownTimeout
+			if timeout <= 0 {
+				timeout = DefaultShutdownTimeout
+			}
+			if err := runWithDeadline(ctx, start.Add(timeout), h.OnShutdown); err != nil {
+				log.Printf("Shutdown hook failed: %v\n", err)
+				errs = append(errs, err)
+			}
+		}
+		l.shutdownErr = errors.Join(errs...)
+	})
+	return l.shutdownErr
+}
+
+// runWithDeadline returns when fn returns or when the deadline passes,
+// whichever comes first, so a stuck hook cannot delay the exit.
+func runWithDeadline(ctx context.Context, deadline time.Time, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown runs the OnShutdown hooks registered with WithHooks. Calling it
+// again has no effect. Call it before the process exits, or have
+// HandleShutdownSignals call it.
+func (r *RequestAccessor) Shutdown(ctx context.Context) error {
+	return r.config().lifecycle.shutdown(ctx)
+}
+
+// exitAfterSignal ends the process once the hooks have run.
+func exitAfterSignal(sig os.Signal) {
+	if p, err := os.FindProcess(os.Getpid()); err == nil {
+		// the handler is gone, this applies the default action of the signal
+		if p.Signal(sig) == nil {
+			return
+		}
+	}
+	os.Exit(1)
+}
+
+// HandleShutdownSignals shuts the accessors down when the process receives
+// SIGTERM or SIGINT, as the runtime sends before recycling an instance,
+// then lets the signal end the process. The accessors are shut down
+// concurrently. Call it once, from main, with the accessors embedded in
+// the adapters:
+//
+//	core.HandleShutdownSignals(ginLambda.RequestAccessor)
+func HandleShutdownSignals(accessors ...*RequestAccessor) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, running shutdown hooks\n", sig)
+		var wg sync.WaitGroup
+		for _, r := range accessors {
+			wg.Add(1)
+			go func(r *RequestAccessor) {
+				defer wg.Done()
+				r.Shutdown(context.Background())
+			}(r)
+		}
+		wg.Wait()
+		signal.Stop(signals)
+		exitAfterSignal(sig)
+	}()
+}
@@ -0,0 +1,116 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+var _ = Describe("Lifecycle hooks tests", func() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	It("Runs init, before and after hooks around invocations", func() {
+		calls := []string{}
+		inits := 0
+		accessor := core.NewRequestAccessor(
+			core.WithHooks(core.Hooks{
+				OnInit: func(ctx context.Context) error {
+					inits++
+					calls = append(calls, "init")
+					if inits == 1 {
+						return errors.New("pool not ready")
+					}
+					return nil
+				},
+				BeforeInvoke: func(ctx context.Context, req events.APIGatewayRequest) {
+					calls = append(calls, "before "+req.Path)
+				},
+				AfterInvoke: func(ctx context.Context, req events.APIGatewayRequest, resp events.APIGatewayResponse, err error) {
+					calls = append(calls, "after "+http.StatusText(resp.StatusCode))
+				},
+			}),
+			core.WithHooks(core.Hooks{
+				BeforeInvoke: func(ctx context.Context, req events.APIGatewayRequest) {
+					calls = append(calls, "second before")
+				},
+			}),
+		)
+
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", "/a").Build())
+		Expect(err).ToNot(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+
+		for _, path := range []string{"/b", "/c"} {
+			resp, err = accessor.ServeEventWithContext(context.Background(), handler, coretest.NewEvent("GET", path).Build())
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		}
+
+		Expect(calls).To(Equal([]string{
+			"init", "after Service Unavailable",
+			"init", "before /b", "second before", "after OK",
+			"before /c", "second before", "after OK",
+		}))
+	})
+
+	It("Runs shutdown hooks once within their timeout", func() {
+		flushed := 0
+		accessor := core.NewRequestAccessor(
+			core.WithHooks(core.Hooks{
+				OnShutdown: func(ctx context.Context) error {
+					flushed++
+					return nil
+				},
+			}),
+			core.WithHooks(core.Hooks{
+				ShutdownTimeout: 20 * time.Millisecond,
+				OnShutdown: func(ctx context.Context) error {
+					time.Sleep(time.Second)
+					return nil
+				},
+			}),
+		)
+
+		start := time.Now()
+		err := accessor.Shutdown(context.Background())
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(flushed).To(Equal(1))
+
+		Expect(accessor.Shutdown(context.Background())).To(Equal(err))
+		Expect(flushed).To(Equal(1))
+	})
+
+	It("Bounds shutdown hooks by one shared deadline", func() {
+		slow := func(ctx context.Context) error {
+			select {
+			case <-time.After(time.Second):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		accessor := core.NewRequestAccessor(
+			core.WithHooks(core.Hooks{ShutdownTimeout: 100 * time.Millisecond, OnShutdown: slow}),
+			core.WithHooks(core.Hooks{ShutdownTimeout: 100 * time.Millisecond, OnShutdown: slow}),
+		)
+
+		start := time.Now()
+		err := accessor.Shutdown(context.Background())
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("<", 180*time.Millisecond))
+	})
+
+	It("Ignores shutdown without hooks", func() {
+		Expect((&core.RequestAccessor{}).Shutdown(context.Background())).To(BeNil())
+	})
+})
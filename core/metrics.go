@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// MetricName is the value of the "metric" field of the JSON lines written
+// by JSONMetricsSink, so log queries can pick them out of other output.
+const MetricName = "scf_api_proxy_invocation"
+
+// Metric describes a single proxied invocation.
+type Metric struct {
+	// Route is the route template that matched the request, for example
+	// "/users/:id". It is empty when the framework did not match a route.
+	Route         string        `json:"route"`
+	Method        string        `json:"method"`
+	Status        int           `json:"status"`
+	Latency       time.Duration `json:"-"`
+	RequestBytes  int           `json:"request_bytes"`
+	ResponseBytes int           `json:"response_bytes"`
+	ColdStart     bool          `json:"cold_start"`
+	// InitDuration is the time spent building lazily initialized values,
+	// see LazyInit, during this invocation.
+	InitDuration time.Duration `json:"-"`
+	Stage        string        `json:"stage"`
+}
+
+// MetricsSink receives a Metric for every invocation. Record is called
+// after the response has been generated and must be safe for concurrent
+// use.
+type MetricsSink interface {
+	Record(ctx context.Context, m Metric)
+}
+
+// WithMetrics records a Metric for every invocation and sends it to the
+// sink. Use NewJSONMetricsSink(os.Stdout) to emit metric lines that CLS can
+// aggregate.
+func WithMetrics(sink MetricsSink) Option {
+	return func(c *config) {
+		c.metrics = sink
+	}
+}
+
+func (c *config) recordMetric(ctx context.Context, req events.APIGatewayRequest, inv *invocation, status int, latency time.Duration) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.Record(ctx, Metric{
+		Route:         inv.route,
+		Method:        req.Method,
+		Status:        status,
+		Latency:       latency,
+		RequestBytes:  int(c.eventBodySize(ctx, req)),
+		ResponseBytes: inv.responseBytes,
+		ColdStart:     inv.coldStart,
+		InitDuration:  inv.initDuration,
+		Stage:         req.Context.Stage,
+	})
+}
+
+// JSONMetricsSink writes every Metric as a single line of JSON.
+type JSONMetricsSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONMetricsSink returns a sink writing to w. A nil writer means
+// os.Stdout, which is collected by CLS.
+func NewJSONMetricsSink(w io.Writer) *JSONMetricsSink {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &JSONMetricsSink{w: w}
+}
+
+type metricLine struct {
+	Name      string  `json:"metric"`
+	Timestamp string  `json:"timestamp"`
+	LatencyMs float64 `json:"latency_ms"`
+	InitMs    float64 `json:"init_ms,omitempty"`
+	Metric
+}
+
+// Record implements MetricsSink.
+func (s *JSONMetricsSink) Record(ctx context.Context, m Metric) {
+	line, err := json.Marshal(metricLine{
+		Name:      MetricName,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		LatencyMs: float64(m.Latency) / float64(time.Millisecond),
+		InitMs:    float64(m.InitDuration) / float64(time.Millisecond),
+		Metric:    m,
+	})
+	if err != nil {
+		log.Println("Could not marshal metric")
+		log.Println(err)
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(line)
+}
+
+// MemoryMetricsSink keeps metrics in memory. It is meant for tests.
+type MemoryMetricsSink struct {
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+// Record implements MetricsSink.
+func (s *MemoryMetricsSink) Record(ctx context.Context, m Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, m)
+}
+
+// Metrics returns a copy of the metrics recorded so far.
+func (s *MemoryMetricsSink) Metrics() []Metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Metric(nil), s.metrics...)
+}
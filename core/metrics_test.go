@@ -0,0 +1,95 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics tests", func() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		core.SetRoute(r, "/orders/{id}")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	It("Records a metric per invocation", func() {
+		sink := &core.MemoryMetricsSink{}
+		accessor := core.NewRequestAccessor(core.WithMetrics(sink))
+
+		req := coretest.NewEvent("POST", "/orders/1").Build()
+		req.Body = `{"a":1}`
+		req.Context = getRequestContext()
+		_, err := accessor.ServeEventWithContext(context.Background(), handler, req)
+		Expect(err).To(BeNil())
+		_, err = accessor.ServeEvent(handler, coretest.NewEvent("BAD METHOD", "/orders/2").Build())
+		Expect(err).ToNot(BeNil())
+
+		metrics := sink.Metrics()
+		Expect(metrics).To(HaveLen(2))
+		Expect(metrics[0].Route).To(Equal("/orders/{id}"))
+		Expect(metrics[0].Method).To(Equal("POST"))
+		Expect(metrics[0].Status).To(Equal(http.StatusCreated))
+		Expect(metrics[0].RequestBytes).To(Equal(7))
+		Expect(metrics[0].ResponseBytes).To(Equal(7))
+		Expect(metrics[0].Stage).To(Equal("prod"))
+		Expect(metrics[0].Latency).To(BeNumerically(">", 0))
+		Expect(metrics[1].Route).To(Equal(""))
+		Expect(metrics[1].Status).To(Equal(http.StatusGatewayTimeout))
+		Expect(metrics[1].ColdStart).To(BeFalse())
+	})
+
+	It("Counts the decoded size of binary bodies", func() {
+		sink := &core.MemoryMetricsSink{}
+		accessor := core.NewRequestAccessor(core.WithMetrics(sink))
+		event := coretest.NewEvent("POST", "/orders/1").BinaryBody([]byte{0xff, 0x00, 0x01, 0x02, 0x03}).Build()
+		_, err := accessor.ServeEvent(handler, event)
+		Expect(err).To(BeNil())
+		// base64 decoders skip line breaks, which do not count
+		event.Body = event.Body[:4] + "\r\n" + event.Body[4:] + "\r\n"
+		_, err = accessor.ServeEvent(handler, event)
+		Expect(err).To(BeNil())
+		Expect(sink.Metrics()).To(HaveLen(2))
+		Expect(sink.Metrics()[0].RequestBytes).To(Equal(5))
+		Expect(sink.Metrics()[1].RequestBytes).To(Equal(5))
+	})
+
+	It("Only asks for the route when it is used", func() {
+		var wanted []bool
+		routeHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wanted = append(wanted, core.WantsRoute(r))
+			w.WriteHeader(http.StatusOK)
+		})
+		_, err := core.NewRequestAccessor().ServeEvent(routeHandler, coretest.NewEvent("GET", "/orders/1").Build())
+		Expect(err).To(BeNil())
+		_, err = core.NewRequestAccessor(core.WithMetrics(&core.MemoryMetricsSink{})).ServeEvent(routeHandler, coretest.NewEvent("GET", "/orders/1").Build())
+		Expect(err).To(BeNil())
+		Expect(wanted).To(Equal([]bool{false, true}))
+	})
+
+	It("Writes metrics as JSON lines", func() {
+		out := &bytes.Buffer{}
+		sink := core.NewJSONMetricsSink(out)
+		sink.Record(context.Background(), core.Metric{Route: "/a", Method: "GET", Status: 200, Latency: 1500 * time.Microsecond, ColdStart: true})
+		sink.Record(context.Background(), core.Metric{Route: "/b", Method: "GET", Status: 404})
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		line := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(lines[0]), &line)).To(BeNil())
+		Expect(line["metric"]).To(Equal(core.MetricName))
+		Expect(line["route"]).To(Equal("/a"))
+		Expect(line["status"]).To(Equal(200.0))
+		Expect(line["latency_ms"]).To(Equal(1.5))
+		Expect(line["cold_start"]).To(Equal(true))
+		Expect(line).To(HaveKey("timestamp"))
+	})
+})
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"net"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a RequestAccessor when it is created with
+// NewRequestAccessor, or an adapter when it is created with New.
+type Option func(*config)
+
+// config holds the settings of a RequestAccessor. A config is never
+// modified once it has been published to an accessor, changes always build
+// a new copy. This is what makes a RequestAccessor safe for concurrent use.
+type config struct {
+	basePaths           []BasePathMapping
+	trailerPolicy       TrailerPolicy
+	tracer              trace.Tracer
+	propagator          propagation.TextMapPropagator
+	metrics             MetricsSink
+	accessLog           *accessLogger
+	requestID           *requestIDConfig
+	warmup              *warmupConfig
+	lifecycle           *lifecycle
+	cors                *corsPolicy
+	ipFilter            *ipFilter
+	rateLimit           *rateLimiter
+	jwtAuth             *jwtAuth
+	keySignature        *keySignature
+	maxBodySize         int64
+	maxDecompressedSize int64
+	base64Header        bool
+}
+
+var defaultConfig = &config{}
+
+func (c *config) clone() *config {
+	n := *c
+	n.basePaths = append([]BasePathMapping(nil), c.basePaths...)
+	return &n
+}
+
+// WithBasePath strips the given base path from the path of every request
+// before routing. See RequestAccessor.StripBasePath.
+func WithBasePath(basePath string) Option {
+	return func(c *config) {
+		c.setBasePath(basePath)
+	}
+}
+
+// WithBasePathMapping strips a base path from the requests for a custom
+// domain and/or stage. See RequestAccessor.AddBasePathMapping.
+func WithBasePathMapping(mapping BasePathMapping) Option {
+	return func(c *config) {
+		c.addBasePathMapping(mapping)
+	}
+}
+
+// WithTrailerPolicy sets what happens to HTTP trailers set by handlers.
+// Trailers are merged into the response headers by default.
+func WithTrailerPolicy(policy TrailerPolicy) Option {
+	return func(c *config) {
+		c.trailerPolicy = policy
+	}
+}
+
+func (c *config) setBasePath(basePath string) string {
+	newBasePath := normalizeBasePath(basePath)
+
+	mappings := make([]BasePathMapping, 0, len(c.basePaths)+1)
+	for _, m := range c.basePaths {
+		if m.Host != "" || m.Stage != "" {
+			mappings = append(mappings, m)
+		}
+	}
+	if newBasePath != "" {
+		mappings = append(mappings, BasePathMapping{BasePath: newBasePath})
+	}
+	c.basePaths = mappings
+
+	return newBasePath
+}
+
+func (c *config) addBasePathMapping(mapping BasePathMapping) string {
+	mapping.BasePath = normalizeBasePath(mapping.BasePath)
+	if mapping.BasePath == "" {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(mapping.Host); err == nil {
+		mapping.Host = host
+	}
+	c.basePaths = append(c.basePaths, mapping)
+	return mapping.BasePath
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// converter turns an event into the http.Request sent to the handler.
+type converter func(ctx context.Context, req events.APIGatewayRequest) (*http.Request, error)
+
+// ServeEvent converts an API Gateway proxy event into an http.Request with
+// ProxyEventToHTTPRequest, sends it to the handler and returns the proxy
+// response generated from the http.ResponseWriter. This is the request path
+// shared by all the framework adapters.
+//
+// The http.ResponseWriter is pooled and handed to later events once h
+// returns, so h must not keep it or write to it from other goroutines
+// after returning.
+func (r *RequestAccessor) ServeEvent(h http.Handler, req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
+	return r.serve(context.Background(), h, req, r.proxyEventToHTTPRequest)
+}
+
+// ServeEventWithContext is like ServeEvent but converts the event with
+// EventToRequestWithContext, so the handler can read the API Gateway and
+// function contexts from the request context. The same restriction on
+// keeping the http.ResponseWriter applies.
+func (r *RequestAccessor) ServeEventWithContext(ctx context.Context, h http.Handler, req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
+	return r.serve(ctx, h, req, r.EventToRequestWithContext)
+}
+
+func (r *RequestAccessor) serve(ctx context.Context, h http.Handler, req events.APIGatewayRequest, convert converter) (events.APIGatewayResponse, error) {
+	cfg := r.config()
+	if cfg.warmup != nil && cfg.warmup.matches(req) && cfg.warmupAllowed(ctx, req) {
+		if err := cfg.lifecycle.init(ctx); err != nil {
+			log.Printf("Could not initialize the function instance during warm-up: %v\n", err)
+		}
+		return cfg.warmup.respond(ctx), nil
+	}
+
+	start := time.Now()
+	inv := newInvocation()
+	inv.wantsRoute = cfg.tracer != nil || cfg.metrics != nil || cfg.accessLog != nil
+	ctx = withInvocation(ctx, inv)
+	ctx, span := cfg.startSpan(ctx, req, inv)
+
+	var resp events.APIGatewayResponse
+	var err error
+	if cfg.ipFilter != nil && !cfg.ipFilter.allowed(cfg, req) {
+		resp = Forbidden()
+	} else if limited, retryAfter := cfg.limited(ctx, req); limited {
+		resp = TooManyRequests(retryAfter)
+	} else if authCtx, refused, authErr := cfg.authenticate(ctx, req); refused != nil {
+		resp, err = *refused, authErr
+	} else if inv.body, refused = cfg.prepareBody(ctx, req); refused != nil {
+		resp = *refused
+	} else if err = cfg.lifecycle.init(ctx); err != nil {
+		resp, err = ServiceUnavailable(), NewLoggedError("Could not initialize the function instance: %v", err)
+	} else {
+		ctx = authCtx
+		cfg.lifecycle.beforeInvoke(ctx, req)
+		if cfg.cors != nil && cfg.cors.isPreflight(req) {
+			resp = cfg.cors.preflight(req)
+		} else {
+			resp, err = cfg.invoke(ctx, span, inv, h, req, convert)
+		}
+	}
+	cfg.decorate(ctx, req, &resp)
+
+	latency := time.Since(start)
+	span.end(inv, resp.StatusCode, err)
+	cfg.recordMetric(ctx, req, inv, resp.StatusCode, latency)
+	if cfg.accessLog != nil {
+		cfg.accessLog.log(ctx, req, inv, resp.StatusCode, start, latency)
+	}
+	cfg.lifecycle.afterInvoke(ctx, req, resp, err)
+	return resp, err
+}
+
+// warmupAllowed reports whether a warm-up ping can be answered. Any client
+// can send a ping through API Gateway, so those must pass the IP filter and
+// the rate limit first; the others go through the pipeline and are refused
+// there. Events without method and path do not come from API Gateway and
+// are always answered.
+func (c *config) warmupAllowed(ctx context.Context, req events.APIGatewayRequest) bool {
+	if req.Method == "" && req.Path == "" {
+		return true
+	}
+	if c.ipFilter != nil && !c.ipFilter.allowed(c, req) {
+		return false
+	}
+	limited, _ := c.limited(ctx, req)
+	return !limited
+}
+
+// limited reports whether the rate limiter refuses the event. CORS
+// preflights are not counted.
+func (c *config) limited(ctx context.Context, req events.APIGatewayRequest) (bool, time.Duration) {
+	if c.rateLimit == nil || (c.cors != nil && c.cors.isPreflight(req)) {
+		return false, 0
+	}
+	return c.rateLimit.limited(ctx, c, req)
+}
+
+// authenticate verifies the key pair signature and the token of the event,
+// when WithKeySignature and WithJWTAuth are set, and returns the context
+// with the verified identities. CORS preflights are not authenticated.
+func (c *config) authenticate(ctx context.Context, req events.APIGatewayRequest) (context.Context, *events.APIGatewayResponse, error) {
+	if (c.keySignature == nil && c.jwtAuth == nil) || (c.cors != nil && c.cors.isPreflight(req)) {
+		return ctx, nil, nil
+	}
+	if c.keySignature != nil {
+		secretID, refused, err := c.keySignature.authenticate(ctx, c, req)
+		if refused != nil {
+			return ctx, refused, err
+		}
+		if secretID != "" {
+			ctx = context.WithValue(ctx, verifiedSecretIDKey{}, secretID)
+		}
+	}
+	if c.jwtAuth != nil {
+		claims, refused, err := c.jwtAuth.authenticate(ctx, c, req)
+		if refused != nil {
+			return ctx, refused, err
+		}
+		if claims != nil {
+			ctx = withJWTClaims(ctx, claims)
+		}
+	}
+	return ctx, nil, nil
+}
+
+// decorate adds the headers configured for every response, whether it was
+// generated by the handler or by the library.
+func (c *config) decorate(ctx context.Context, req events.APIGatewayRequest, resp *events.APIGatewayResponse) {
+	if c.requestID != nil {
+		c.requestID.decorate(ctx, req, resp)
+	}
+	if c.cors != nil && !c.cors.isPreflight(req) {
+		c.cors.decorate(req, resp)
+	}
+}
+
+// invoke converts the event, runs the handler and encodes its response.
+func (c *config) invoke(ctx context.Context, span *invocationSpan, inv *invocation, h http.Handler, req events.APIGatewayRequest, convert converter) (events.APIGatewayResponse, error) {
+	_, endConvert := span.phase(ctx, "event.convert")
+	httpRequest, err := convert(ctx, req)
+	endConvert()
+	if err != nil {
+		return GatewayTimeout(), NewLoggedError("Could not convert proxy event to request: %v", err)
+	}
+
+	respWriter := acquireResponseWriter(c.trailerPolicy)
+	handlerCtx, endHandler := span.phase(httpRequest.Context(), "handler")
+	if span.span != nil {
+		// the request only needs a new context for the handler span
+		httpRequest = httpRequest.WithContext(handlerCtx)
+	}
+	h.ServeHTTP(http.ResponseWriter(respWriter), httpRequest)
+	endHandler()
+
+	_, endEncode := span.phase(ctx, "response.encode")
+	proxyResponse, err := respWriter.GetProxyResponse()
+	endEncode()
+	inv.responseBytes = respWriter.body.Len()
+	releaseResponseWriter(respWriter)
+	if err != nil {
+		return GatewayTimeout(), NewLoggedError("Error while generating proxy response: %v", err)
+	}
+
+	return proxyResponse, nil
+}
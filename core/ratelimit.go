@@ -0,0 +1,244 @@
+package core
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// RateLimit is the size and refill rate of a token bucket: Requests tokens
+// are added every Per, up to Burst. A zero Burst means Requests. The zero
+// RateLimit does not limit anything.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l RateLimit) unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// rate returns the number of tokens added per second.
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// RouteRateLimit applies a limit to the paths under a prefix.
+type RouteRateLimit struct {
+	PathPrefix string
+	Limit      RateLimit
+}
+
+// RateLimitKey returns the key requests are counted under, such as the
+// client address. Requests with an empty key share one bucket.
+type RateLimitKey func(req events.APIGatewayRequest) string
+
+// KeyBySourceIP counts requests per client address, as verified by API
+// Gateway.
+func KeyBySourceIP() RateLimitKey {
+	return func(req events.APIGatewayRequest) string {
+		return req.Context.SourceIP
+	}
+}
+
+// KeyByHeader counts requests per value of a header, such as an API key.
+func KeyByHeader(name string) RateLimitKey {
+	return func(req events.APIGatewayRequest) string {
+		return eventHeader(req, name)
+	}
+}
+
+// KeyBySecretID counts requests per API Gateway key pair, the secret ID of
+// the identity in the request context.
+func KeyBySecretID() RateLimitKey {
+	return func(req events.APIGatewayRequest) string {
+		if id := req.Context.Identity.SecretID; id != nil {
+			return *id
+		}
+		return ""
+	}
+}
+
+// RateLimitStore keeps the token buckets. MemoryRateLimitStore keeps them
+// in the function instance; an implementation backed by a shared server
+// such as Redis applies the limits across instances.
+type RateLimitStore interface {
+	// Take removes a token from the bucket of key, created full if it does
+	// not exist, and reports whether one was available. When it was not,
+	// retryAfter is the time until the next token.
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitConfig configures WithRateLimit.
+type RateLimitConfig struct {
+	// Key identifies the client, KeyBySourceIP() when nil.
+	Key RateLimitKey
+	// Limit applies to the paths without a route limit.
+	Limit RateLimit
+	// Routes are the limits of path prefixes. The longest matching prefix
+	// applies, and each route counts requests separately.
+	Routes []RouteRateLimit
+	// Store keeps the buckets, a new MemoryRateLimitStore when nil.
+	Store RateLimitStore
+}
+
+type rateLimiter struct {
+	key    RateLimitKey
+	limit  RateLimit
+	routes []RouteRateLimit
+	store  RateLimitStore
+}
+
+// WithRateLimit limits the rate of requests per client with token buckets.
+// Requests over the limit get 429 Too Many Requests with a Retry-After
+// header, before the framework runs. The path is matched as the framework
+// routes it, after the base path is stripped, see WithIPFilter. CORS
+// preflights are not counted. When the store fails the request is let through and the error
+// logged.
+func WithRateLimit(cfg RateLimitConfig) Option {
+	l := &rateLimiter{key: cfg.Key, limit: cfg.Limit, store: cfg.Store}
+	if l.key == nil {
+		l.key = KeyBySourceIP()
+	}
+	if l.store == nil {
+		l.store = NewMemoryRateLimitStore()
+	}
+	for _, route := range cfg.Routes {
+		route.PathPrefix = normalizeBasePath(route.PathPrefix)
+		l.routes = append(l.routes, route)
+	}
+	return func(c *config) {
+		c.rateLimit = l
+	}
+}
+
+// limited counts the request and reports whether it is over the limit,
+// with the time until the client can retry. A request whose paths fall
+// under different routes, through encoded characters or dot segments, is
+// counted by each of them.
+func (l *rateLimiter) limited(ctx context.Context, c *config, req events.APIGatewayRequest) (bool, time.Duration) {
+	counted := make([]string, 0, 3)
+	limited, wait := false, time.Duration(0)
+	for _, p := range routingPaths(c, req) {
+		prefix, limit := l.match(p)
+		if limit.unlimited() || containsString(counted, prefix) {
+			continue
+		}
+		counted = append(counted, prefix)
+		allowed, retryAfter, err := l.store.Take(ctx, prefix+"\x00"+l.key(req), limit, time.Now())
+		if err != nil {
+			log.Printf("Rate limit store failed, letting the request through: %v\n", err)
+			continue
+		}
+		if !allowed {
+			limited = true
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+		}
+	}
+	return limited, wait
+}
+
+func (l *rateLimiter) match(path string) (string, RateLimit) {
+	prefix, limit := "", l.limit
+	for _, route := range l.routes {
+		if hasPathPrefix(path, route.PathPrefix) && len(route.PathPrefix) > len(prefix) {
+			prefix, limit = route.PathPrefix, route.Limit
+		}
+	}
+	return prefix, limit
+}
+
+// sweepInterval is the number of Take calls between two removals of the
+// buckets that have refilled.
+const sweepInterval = 1024
+
+// MemoryRateLimitStore keeps token buckets in memory. Buckets that have
+// refilled are removed from time to time, so the store does not grow with
+// every client ever seen.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, time.Duration, error) {
+	if limit.unlimited() {
+		return true, 0, nil
+	}
+	rate, burst := limit.rate(), limit.burst()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.takes++
+	if s.takes%sweepInterval == 0 {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, updated: now}
+		s.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait, nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((burst - b.tokens) / rate * float64(time.Second)))
+	return true, 0, nil
+}
+
+// sweep removes the buckets that are full again, they are recreated full.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets in the store.
+func (s *MemoryRateLimitStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, core.RateLimit, time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("store unavailable")
+}
+
+var _ = Describe("Rate limit tests", func() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(accessor *core.RequestAccessor, req events.APIGatewayRequest) events.APIGatewayResponse {
+		resp, err := accessor.ServeEvent(handler, req)
+		Expect(err).To(BeNil())
+		return resp
+	}
+
+	It("Refuses requests over the limit with Retry-After", func() {
+		accessor := core.NewRequestAccessor(core.WithRateLimit(core.RateLimitConfig{
+			Limit: core.RateLimit{Requests: 2, Per: time.Hour},
+		}))
+		req := coretest.NewEvent("GET", "/orders").SourceIP("10.0.0.1").Build()
+		Expect(serve(accessor, req).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(accessor, req).StatusCode).To(Equal(http.StatusOK))
+
+		resp := serve(accessor, req)
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Headers).To(HaveKeyWithValue("Retry-After", "1800"))
+
+		other := coretest.NewEvent("GET", "/orders").SourceIP("10.0.0.2").Build()
+		Expect(serve(accessor, other).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Applies per route limits counted separately", func() {
+		accessor := core.NewRequestAccessor(
+			core.WithBasePath("/api"),
+			core.WithRateLimit(core.RateLimitConfig{
+				Routes: []core.RouteRateLimit{
+					{PathPrefix: "/login", Limit: core.RateLimit{Requests: 1, Per: time.Minute}},
+					{PathPrefix: "/orders", Limit: core.RateLimit{Requests: 1, Per: time.Minute, Burst: 2}},
+				},
+			}),
+		)
+		event := func(path string) events.APIGatewayRequest {
+			return coretest.NewEvent("GET", path).SourceIP("10.0.0.1").Build()
+		}
+		Expect(serve(accessor, event("/api/login")).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(accessor, event("/api/%6Cogin")).StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(serve(accessor, event("/api/login/../products")).StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(serve(accessor, event("/api/products/../login")).StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(serve(accessor, event("/api/orders/1")).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(accessor, event("/api/orders/2")).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(accessor, event("/api/orders")).StatusCode).To(Equal(http.StatusTooManyRequests))
+		for i := 0; i < 5; i++ {
+			Expect(serve(accessor, event("/api/products")).StatusCode).To(Equal(http.StatusOK))
+		}
+	})
+
+	It("Keys requests by header or secret ID", func() {
+		byHeader := core.NewRequestAccessor(core.WithRateLimit(core.RateLimitConfig{
+			Key:   core.KeyByHeader("X-Api-Key"),
+			Limit: core.RateLimit{Requests: 1, Per: time.Minute},
+		}))
+		first := coretest.NewEvent("GET", "/").Header("x-api-key", "first").Build()
+		second := coretest.NewEvent("GET", "/").Header("X-Api-Key", "second").Build()
+		Expect(serve(byHeader, first).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(byHeader, second).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(byHeader, first).StatusCode).To(Equal(http.StatusTooManyRequests))
+
+		bySecretID := core.NewRequestAccessor(core.WithRateLimit(core.RateLimitConfig{
+			Key:   core.KeyBySecretID(),
+			Limit: core.RateLimit{Requests: 1, Per: time.Minute},
+		}))
+		withSecretID := func(id string) events.APIGatewayRequest {
+			return coretest.NewEvent("GET", "/").SecretID(id).Build()
+		}
+		Expect(serve(bySecretID, withSecretID("AKID1")).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(bySecretID, withSecretID("AKID2")).StatusCode).To(Equal(http.StatusOK))
+		Expect(serve(bySecretID, withSecretID("AKID1")).StatusCode).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("Does not count CORS preflights", func() {
+		accessor := core.NewRequestAccessor(
+			core.WithCORS(core.CORSConfig{AllowOrigins: []string{"*"}}),
+			core.WithRateLimit(core.RateLimitConfig{Limit: core.RateLimit{Requests: 1, Per: time.Minute}}),
+		)
+		preflight := coretest.NewEvent("OPTIONS", "/").
+			Header("Origin", "https://example.com").
+			Header("Access-Control-Request-Method", "POST").
+			Build()
+		Expect(serve(accessor, preflight).StatusCode).To(Equal(http.StatusNoContent))
+		Expect(serve(accessor, preflight).StatusCode).To(Equal(http.StatusNoContent))
+
+		req := coretest.NewEvent("POST", "/").Header("Origin", "https://example.com").Build()
+		Expect(serve(accessor, req).StatusCode).To(Equal(http.StatusOK))
+		resp := serve(accessor, req)
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Headers).To(HaveKeyWithValue("Access-Control-Allow-Origin", "*"))
+	})
+
+	It("Lets requests through when the store fails", func() {
+		accessor := core.NewRequestAccessor(core.WithRateLimit(core.RateLimitConfig{
+			Limit: core.RateLimit{Requests: 1, Per: time.Minute},
+			Store: failingRateLimitStore{},
+		}))
+		Expect(serve(accessor, coretest.NewEvent("GET", "/").Build()).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("Refills the memory store over time", func() {
+		store := core.NewMemoryRateLimitStore()
+		limit := core.RateLimit{Requests: 10, Per: time.Second, Burst: 2}
+		now := time.Unix(1700000000, 0)
+		take := func(at time.Duration) (bool, time.Duration) {
+			allowed, retryAfter, err := store.Take(context.Background(), "client", limit, now.Add(at))
+			Expect(err).To(BeNil())
+			return allowed, retryAfter
+		}
+		Expect(take(0)).To(BeTrue())
+		Expect(take(0)).To(BeTrue())
+		allowed, retryAfter := take(0)
+		Expect(allowed).To(BeFalse())
+		Expect(retryAfter).To(BeNumerically("~", 100*time.Millisecond, time.Millisecond))
+
+		Expect(take(100 * time.Millisecond)).To(BeTrue())
+		allowed, _ = take(100 * time.Millisecond)
+		Expect(allowed).To(BeFalse())
+		Expect(take(time.Hour)).To(BeTrue())
+		Expect(take(time.Hour)).To(BeTrue())
+		allowed, _ = take(time.Hour)
+		Expect(allowed).To(BeFalse())
+	})
+
+	It("Removes the buckets that have refilled", func() {
+		store := core.NewMemoryRateLimitStore()
+		limit := core.RateLimit{Requests: 1, Per: time.Second}
+		now := time.Unix(1700000000, 0)
+		for i := 0; i < 1000; i++ {
+			store.Take(context.Background(), string(rune('a'+i%26))+string(rune(i)), limit, now)
+		}
+		Expect(store.Len()).To(Equal(1000))
+		for i := 0; i < 100; i++ {
+			store.Take(context.Background(), "late", limit, now.Add(time.Minute))
+		}
+		Expect(store.Len()).To(Equal(1))
+	})
+})
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// EventToResponse converts an events.APIGatewayResponse, as returned by the
+// adapters, into an http.Response. Base64 encoded bodies are decoded and
+// ContentLength is set to the length of the decoded body. The response is
+// returned for an HTTP/1.1 request with no Request attached.
+func EventToResponse(resp events.APIGatewayResponse) (*http.Response, error) {
+	if resp.StatusCode < 100 || resp.StatusCode > 999 {
+		return nil, fmt.Errorf("invalid status code %d in proxy response", resp.StatusCode)
+	}
+	body, err := decodeResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResponse := &http.Response{
+		Status:        strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        responseHeaders(resp),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	return httpResponse, nil
+}
+
+// WriteProxyResponse replays an events.APIGatewayResponse onto w: it copies
+// the headers, writes the status code and the decoded body. Content-Length
+// is set when the response does not declare it. The body is dropped for
+// status codes that do not allow one, such as 204 and 304.
+func WriteProxyResponse(w http.ResponseWriter, resp events.APIGatewayResponse) error {
+	if resp.StatusCode < 100 || resp.StatusCode > 999 {
+		return fmt.Errorf("invalid status code %d in proxy response", resp.StatusCode)
+	}
+	body, err := decodeResponseBody(resp)
+	if err != nil {
+		return err
+	}
+
+	header := w.Header()
+	for k, v := range responseHeaders(resp) {
+		header[k] = v
+	}
+	if !bodyAllowed(resp.StatusCode) {
+		w.WriteHeader(resp.StatusCode)
+		return nil
+	}
+	if header.Get("Content-Length") == "" {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, err = w.Write(body)
+	return err
+}
+
+// bodyAllowed reports whether a response with the status code can have a
+// body, following RFC 7230, section 3.3.
+func bodyAllowed(status int) bool {
+	return (status < 100 || status > 199) && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func decodeResponseBody(resp events.APIGatewayResponse) ([]byte, error) {
+	if !resp.IsBase64Encoded {
+		return []byte(resp.Body), nil
+	}
+	body, err := base64.StdEncoding.DecodeString(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode base64 body of proxy response: %w", err)
+	}
+	return body, nil
+}
+
+func responseHeaders(resp events.APIGatewayResponse) http.Header {
+	header := make(http.Header, len(resp.Headers))
+	for k, v := range resp.Headers {
+		header.Set(k, v)
+	}
+	return header
+}
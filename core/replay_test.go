@@ -0,0 +1,103 @@
+package core_test
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+var _ = Describe("Response replay tests", func() {
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+
+	It("Converts a text response to http.Response", func() {
+		resp, err := core.EventToResponse(events.APIGatewayResponse{
+			StatusCode: http.StatusCreated,
+			Headers:    map[string]string{"content-type": "application/json"},
+			Body:       `{"id":1}`,
+		})
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		Expect(resp.Status).To(Equal("201 Created"))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(resp.ContentLength).To(Equal(int64(8)))
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).To(BeNil())
+		Expect(string(body)).To(Equal(`{"id":1}`))
+	})
+
+	It("Decodes base64 bodies", func() {
+		resp, err := core.EventToResponse(events.APIGatewayResponse{
+			StatusCode:      http.StatusOK,
+			Body:            base64.StdEncoding.EncodeToString(binary),
+			IsBase64Encoded: true,
+		})
+		Expect(err).To(BeNil())
+		Expect(resp.ContentLength).To(Equal(int64(len(binary))))
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).To(BeNil())
+		Expect(body).To(Equal(binary))
+	})
+
+	It("Rejects invalid responses", func() {
+		_, err := core.EventToResponse(events.APIGatewayResponse{})
+		Expect(err).ToNot(BeNil())
+
+		_, err = core.EventToResponse(events.APIGatewayResponse{
+			StatusCode:      http.StatusOK,
+			Body:            "not base64!",
+			IsBase64Encoded: true,
+		})
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("Replays a response onto a ResponseWriter", func() {
+		recorder := httptest.NewRecorder()
+		err := core.WriteProxyResponse(recorder, events.APIGatewayResponse{
+			StatusCode:      http.StatusAccepted,
+			Headers:         map[string]string{"Content-Type": "image/png", "X-Custom": "value"},
+			Body:            base64.StdEncoding.EncodeToString(binary),
+			IsBase64Encoded: true,
+		})
+		Expect(err).To(BeNil())
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("image/png"))
+		Expect(recorder.Header().Get("X-Custom")).To(Equal("value"))
+		Expect(recorder.Header().Get("Content-Length")).To(Equal("6"))
+		Expect(recorder.Body.Bytes()).To(Equal(binary))
+	})
+
+	It("Drops bodies of responses that cannot have one", func() {
+		recorder := httptest.NewRecorder()
+		err := core.WriteProxyResponse(recorder, events.APIGatewayResponse{
+			StatusCode: http.StatusNoContent,
+			Body:       "ignored",
+		})
+		Expect(err).To(BeNil())
+		Expect(recorder.Code).To(Equal(http.StatusNoContent))
+		Expect(recorder.Body.Len()).To(Equal(0))
+	})
+
+	It("Round trips with ProxyResponseWriter", func() {
+		writer := core.NewProxyResponseWriter()
+		writer.Header().Set("Content-Type", "image/png")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(binary)
+		proxyResponse, err := writer.GetProxyResponse()
+		Expect(err).To(BeNil())
+
+		resp, err := core.EventToResponse(proxyResponse)
+		Expect(err).To(BeNil())
+		Expect(resp.Header.Get("Content-Type")).To(Equal("image/png"))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).To(BeNil())
+		Expect(body).To(Equal(binary))
+	})
+})
@@ -1,5 +1,10 @@
 // Package core provides utility methods that help convert proxy events
-// into an http.Request and http.ResponseWriter
+// into an http.Request and http.ResponseWriter.
+//
+// A RequestAccessor, and the adapters that embed one, can be used by
+// multiple goroutines at the same time. Its configuration is fixed when it
+// is created with options; every invocation gets its own http.Request and
+// ProxyResponseWriter.
 package core
 
 import (
@@ -8,11 +13,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/tencentyun/scf-go-lib/events"
 	"github.com/tencentyun/scf-go-lib/functioncontext"
@@ -33,16 +42,54 @@ const DefaultServerAddress = "https://tencent-serverless-go-api.com"
 const APIGwContextHeader = "X-GoLambdaProxy-ApiGw-Context"
 
 // RequestAccessor objects give access to custom API Gateway properties
-// in the request.
+// in the request. The zero value is ready to use, NewRequestAccessor
+// creates an accessor with options. A RequestAccessor must not be copied
+// after first use.
 type RequestAccessor struct {
-	stripBasePath string
+	cfg atomic.Pointer[config]
+	// mu serializes the legacy setters, readers never take it
+	mu sync.Mutex
+}
+
+// NewRequestAccessor returns a RequestAccessor configured with the given
+// options. The configuration cannot change afterwards.
+func NewRequestAccessor(opts ...Option) *RequestAccessor {
+	c := defaultConfig.clone()
+	for _, opt := range opts {
+		opt(c)
+	}
+	r := &RequestAccessor{}
+	r.cfg.Store(c)
+	return r
+}
+
+func (r *RequestAccessor) config() *config {
+	if c := r.cfg.Load(); c != nil {
+		return c
+	}
+	return defaultConfig
+}
+
+// update applies fn to a copy of the configuration and publishes the copy,
+// so requests being converted concurrently keep a consistent view.
+func (r *RequestAccessor) update(fn func(c *config) string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.config().clone()
+	result := fn(c)
+	r.cfg.Store(c)
+	return result
 }
 
 // GetAPIGatewayContext extracts the API Gateway context object from a
 // request's custom header.
 // Returns a populated events.APIGatewayProxyRequestContext object from
-// the request.
+// the request. Requests created with EventToRequestWithContext carry the
+// context in their context.Context, which is returned instead.
 func (r *RequestAccessor) GetAPIGatewayContext(req *http.Request) (events.APIGatewayRequestContext, error) {
+	if rc, ok := GetAPIGatewayContextFromContext(req.Context()); ok {
+		return rc, nil
+	}
 	if req.Header.Get(APIGwContextHeader) == "" {
 		return events.APIGatewayRequestContext{}, errors.New("No context header in request")
 	}
@@ -59,32 +106,44 @@ func (r *RequestAccessor) GetAPIGatewayContext(req *http.Request) (events.APIGat
 // StripBasePath instructs the RequestAccessor object that the given base
 // path should be removed from the request path before sending it to the
 // framework for routing. This is used when API Gateway is configured with
-// base path mappings in custom domain names.
+// base path mappings in custom domain names. The base path applies to every
+// host and stage, use AddBasePathMapping for more specific mappings.
+//
+// Deprecated: pass WithBasePath to NewRequestAccessor or to the adapter
+// constructor instead. Calling StripBasePath once the accessor has started
+// serving events is not supported: it does not race, but events being
+// converted keep the old base path while the next ones get the new one.
 func (r *RequestAccessor) StripBasePath(basePath string) string {
-	if strings.Trim(basePath, " ") == "" {
-		r.stripBasePath = ""
-		return ""
-	}
-
-	newBasePath := basePath
-	if !strings.HasPrefix(newBasePath, "/") {
-		newBasePath = "/" + newBasePath
-	}
-
-	if strings.HasSuffix(newBasePath, "/") {
-		newBasePath = newBasePath[:len(newBasePath)-1]
-	}
-
-	r.stripBasePath = newBasePath
+	return r.update(func(c *config) string {
+		return c.setBasePath(basePath)
+	})
+}
 
-	return newBasePath
+// AddBasePathMapping adds a base path that is only stripped from requests
+// for the given custom domain and/or stage. When several mappings match a
+// request the one naming both host and stage wins over the one naming only
+// the host, which wins over the one naming only the stage.
+// Returns the normalized base path, or an empty string if the mapping was
+// ignored because its base path is blank.
+//
+// Deprecated: pass WithBasePathMapping to NewRequestAccessor or to the
+// adapter constructor instead. Like StripBasePath, it is not supported once
+// the accessor has started serving events.
+func (r *RequestAccessor) AddBasePathMapping(mapping BasePathMapping) string {
+	return r.update(func(c *config) string {
+		return c.addBasePathMapping(mapping)
+	})
 }
 
 // ProxyEventToHTTPRequest converts an API Gateway proxy event into a http.Request object.
 // Returns the populated http request with additional two custom headers for the stage variables and API Gateway context.
 // To access these properties use the GetAPIGatewayStageVars and GetAPIGatewayContext method of the RequestAccessor object.
 func (r *RequestAccessor) ProxyEventToHTTPRequest(req events.APIGatewayRequest) (*http.Request, error) {
-	httpRequest, err := r.EventToRequest(req)
+	return r.proxyEventToHTTPRequest(context.Background(), req)
+}
+
+func (r *RequestAccessor) proxyEventToHTTPRequest(ctx context.Context, req events.APIGatewayRequest) (*http.Request, error) {
+	httpRequest, err := r.eventToRequest(ctx, req, false)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -96,22 +155,46 @@ func (r *RequestAccessor) ProxyEventToHTTPRequest(req events.APIGatewayRequest)
 // Returns the populated http request with lambda context, stage variables and APIGatewayProxyRequestContext as part of its context.
 // Access those using GetAPIGatewayContextFromContext, GetStageVarsFromContext and GetRuntimeContextFromContext functions in this package.
 func (r *RequestAccessor) EventToRequestWithContext(ctx context.Context, req events.APIGatewayRequest) (*http.Request, error) {
-	httpRequest, err := r.EventToRequest(req)
+	httpRequest, err := r.eventToRequest(ctx, req, true)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	return addToContext(ctx, httpRequest, req), nil
+	return httpRequest, nil
 }
 
 // EventToRequest converts an API Gateway proxy event into an http.Request object.
 // Returns the populated request maintaining headers
 func (r *RequestAccessor) EventToRequest(req events.APIGatewayRequest) (*http.Request, error) {
+	return r.eventToRequest(context.Background(), req, false)
+}
+
+// gatewayHeaderKeys are the canonical names of the headers eventToRequest
+// adds from the request context, in the order of gatewayHeaderValues.
+var gatewayHeaderKeys = [...]string{
+	"X-Apigateway-Serviceid",
+	"X-Apigateway-Requestid",
+	"X-Apigateway-Method",
+	"X-Apigateway-Path",
+	"X-Apigateway-Sourceip",
+	"X-Forwarded-For",
+	"X-Apigateway-Stage",
+}
+
+func gatewayHeaderValues(rc events.APIGatewayRequestContext) [len(gatewayHeaderKeys)]string {
+	return [...]string{rc.ServiceID, rc.RequestID, rc.Method, rc.Path, rc.SourceIP, rc.SourceIP, rc.Stage}
+}
+
+// eventToRequest builds the http.Request for an event. When withContext is
+// set the API Gateway and function contexts are stored in the request
+// context, in the same allocation as the request.
+func (r *RequestAccessor) eventToRequest(ctx context.Context, req events.APIGatewayRequest, withContext bool) (*http.Request, error) {
+	c := r.config()
 	path := req.Path
-	if r.stripBasePath != "" && len(r.stripBasePath) > 1 {
-		if strings.HasPrefix(path, r.stripBasePath) {
-			path = strings.Replace(path, r.stripBasePath, "", 1)
-		}
+	basePath := selectBasePath(c.basePaths, req)
+	if basePath != "" {
+		path = path[len(basePath):]
+		ctx = context.WithValue(ctx, basePathKey{}, basePath)
 	}
 	if !strings.HasPrefix(path, "/") {
 		path = "/" + path
@@ -120,43 +203,152 @@ func (r *RequestAccessor) EventToRequest(req events.APIGatewayRequest) (*http.Re
 	if customAddress, ok := os.LookupEnv(CustomHostVariable); ok {
 		serverAddress = customAddress
 	}
-	path = serverAddress + path
+	requestURL, err := buildURL(serverAddress, path, req.QueryString)
+	if err != nil {
+		log.Printf("Could not build URL for request %s:%s\n", req.Method, req.Path)
+		log.Println(err)
+		return nil, err
+	}
 
-	if len(req.QueryString) > 0 {
-		queryString := ""
-		for q := range req.QueryString {
-			if queryString != "" {
-				queryString += "&"
-			}
-			queryString += url.QueryEscape(q) + "=" + url.QueryEscape(req.QueryString[q][0])
-		}
-		path += "?" + queryString
+	// a body prepared by the proxy pipeline, once decompressed, replaces
+	// the body of the event and its encoding headers
+	var body io.Reader
+	prepared := preparedBody(ctx)
+	if prepared != nil {
+		body = bytes.NewReader(prepared)
+	} else if body, err = c.eventBodyReader(ctx, req); err != nil {
+		log.Printf("Could not decode base64 body of request %s:%s\n", req.Method, req.Path)
+		return nil, err
 	}
 
-	httpRequest, err := http.NewRequest(
+	if withContext {
+		lc, _ := functioncontext.FromContext(ctx)
+		ctx = context.WithValue(ctx, ctxKey{}, requestContext{lambdaContext: lc, gatewayProxyContext: req.Context})
+	}
+
+	// the request is created for the server address only and then given the
+	// URL we built, so the full URL is not formatted and parsed back, and
+	// Path and RawPath are exactly what we decided on
+	httpRequest, err := http.NewRequestWithContext(
+		ctx,
 		strings.ToUpper(req.Method),
-		path,
-		bytes.NewBufferString(req.Body),
+		serverAddress,
+		body,
 	)
-
 	if err != nil {
 		fmt.Printf("Could not convert request %s:%s to http.Request\n", req.Method, req.Path)
 		log.Println(err)
 		return nil, err
 	}
-	for h := range req.Headers {
-		httpRequest.Header.Add(h, req.Headers[h])
+	httpRequest.URL = requestURL
+	httpRequest.Host = requestURL.Host
+
+	// all header values share one backing array, each header gets a
+	// single-element slice of it
+	header := make(http.Header, len(req.Headers)+len(gatewayHeaderKeys))
+	values := make([]string, 0, len(req.Headers)+len(gatewayHeaderKeys))
+	add := func(key, value string) {
+		if existing, ok := header[key]; ok {
+			header[key] = append(existing, value)
+			return
+		}
+		values = append(values, value)
+		header[key] = values[len(values)-1 : len(values) : len(values)]
+	}
+	for h, v := range req.Headers {
+		key := http.CanonicalHeaderKey(h)
+		switch {
+		case key == http.CanonicalHeaderKey(Base64EncodedHeader):
+			continue
+		case prepared != nil && key == "Content-Encoding":
+			continue
+		case prepared != nil && key == "Content-Length":
+			v = strconv.Itoa(len(prepared))
+		}
+		add(key, v)
+	}
+	for i, v := range gatewayHeaderValues(req.Context) {
+		key := gatewayHeaderKeys[i]
+		if key != "X-Forwarded-For" {
+			// the values verified by API Gateway replace the ones sent by
+			// the client, so the headers cannot be spoofed
+			delete(header, key)
+		}
+		add(key, v)
 	}
-	httpRequest.Header.Add(http.CanonicalHeaderKey("x-apigateway-serviceid"), req.Context.ServiceID)
-	httpRequest.Header.Add(http.CanonicalHeaderKey("x-apigateway-requestid"), req.Context.RequestID)
-	httpRequest.Header.Add(http.CanonicalHeaderKey("x-apigateway-method"), req.Context.Method)
-	httpRequest.Header.Add(http.CanonicalHeaderKey("x-apigateway-path"), req.Context.Path)
-	httpRequest.Header.Add(http.CanonicalHeaderKey("x-apigateway-sourceip"), req.Context.SourceIP)
-	httpRequest.Header.Add(http.CanonicalHeaderKey("x-forwarded-for"), req.Context.SourceIP)
-	httpRequest.Header.Add(http.CanonicalHeaderKey("x-apigateway-stage"), req.Context.Stage)
+	httpRequest.Header = header
 	return httpRequest, nil
 }
 
+// buildURL joins the server address with the escaped request path and the
+// query string parameters of the event. The path is kept in its original
+// encoding through URL.RawPath, so that an encoded slash (%2F) is not
+// confused with a path separator. Paths that are not valid escaped strings,
+// for example "/100%", are taken literally.
+func buildURL(serverAddress string, path string, query events.APIGatewayQueryString) (*url.URL, error) {
+	base, err := parseServerAddress(serverAddress)
+	if err != nil {
+		return nil, err
+	}
+	u := new(url.URL)
+	*u = *base
+
+	rawPath := u.EscapedPath() + path
+	if decoded, err := url.PathUnescape(rawPath); err == nil {
+		u.Path = decoded
+		u.RawPath = rawPath
+		// RawPath is only kept when it is a valid encoding that differs from
+		// the default one, the same rule url.Parse applies
+		if u.EscapedPath() != rawPath || (&url.URL{Path: decoded}).EscapedPath() == rawPath {
+			u.RawPath = ""
+		}
+	} else {
+		u.Path = u.Path + path
+		u.RawPath = ""
+	}
+
+	if len(query) > 0 {
+		values := make(url.Values, len(query))
+		for k, v := range query {
+			if len(v) == 0 {
+				// flags such as ?debug are delivered without a value
+				values[k] = []string{""}
+				continue
+			}
+			values[k] = v
+		}
+		u.RawQuery = values.Encode()
+	}
+	return u, nil
+}
+
+// serverURL is a parsed server address.
+type serverURL struct {
+	address string
+	url     *url.URL
+}
+
+// lastServerURL caches the last server address parsed, which is the same
+// for every invocation unless CustomHostVariable changes.
+var lastServerURL atomic.Pointer[serverURL]
+
+// parseServerAddress parses and validates the server address. The returned
+// URL is shared and must not be modified.
+func parseServerAddress(serverAddress string) (*url.URL, error) {
+	if cached := lastServerURL.Load(); cached != nil && cached.address == serverAddress {
+		return cached.url, nil
+	}
+	u, err := url.Parse(strings.TrimSuffix(serverAddress, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("server address %q must include a scheme and a host", serverAddress)
+	}
+	lastServerURL.Store(&serverURL{address: serverAddress, url: u})
+	return u, nil
+}
+
 func addToHeader(req *http.Request, apiGwRequest events.APIGatewayRequest) (*http.Request, error) {
 	apiGwContext, err := json.Marshal(apiGwRequest.Context)
 	if err != nil {
@@ -167,13 +359,6 @@ func addToHeader(req *http.Request, apiGwRequest events.APIGatewayRequest) (*htt
 	return req, nil
 }
 
-func addToContext(ctx context.Context, req *http.Request, apiGwRequest events.APIGatewayRequest) *http.Request {
-	lc, _ := functioncontext.FromContext(ctx)
-	rc := requestContext{lambdaContext: lc, gatewayProxyContext: apiGwRequest.Context}
-	ctx = context.WithValue(ctx, ctxKey{}, rc)
-	return req.WithContext(ctx)
-}
-
 // GetAPIGatewayContextFromContext retrieve APIGatewayProxyRequestContext from context.Context
 func GetAPIGatewayContextFromContext(ctx context.Context) (events.APIGatewayRequestContext, bool) {
 	v, ok := ctx.Value(ctxKey{}).(requestContext)
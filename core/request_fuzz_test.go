@@ -0,0 +1,68 @@
+package core_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+func FuzzEventToRequestURL(f *testing.F) {
+	f.Add("/hello", "name", "world")
+	f.Add("/files/a%2Fb", "q", "a b")
+	f.Add("/a b/c", "k", "&=?#")
+	f.Add("/a#b?c", "", "")
+	f.Add("/café/ü", "ключ", "значение")
+	f.Add("/100%", "%zz", "%")
+	f.Add("orders", "a;b", "c;d")
+
+	f.Fuzz(func(t *testing.T, path string, key string, value string) {
+		accessor := core.RequestAccessor{}
+		req := events.APIGatewayRequest{
+			Path:        path,
+			Method:      "GET",
+			QueryString: events.APIGatewayQueryString{key: {value}},
+		}
+		httpReq, err := accessor.EventToRequestWithContext(context.Background(), req)
+		if err != nil {
+			return
+		}
+
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		expectedPath := path
+		if decoded, err := url.PathUnescape(path); err == nil {
+			expectedPath = decoded
+		}
+		if httpReq.URL.Path != expectedPath {
+			t.Fatalf("path %q converted to %q, expected %q", path, httpReq.URL.Path, expectedPath)
+		}
+		if unescaped, err := url.PathUnescape(httpReq.URL.EscapedPath()); err != nil || unescaped != httpReq.URL.Path {
+			t.Fatalf("escaped path %q does not decode to %q", httpReq.URL.EscapedPath(), httpReq.URL.Path)
+		}
+		if parsed, err := url.Parse("http://host" + path); err == nil && parsed.RawQuery == "" && parsed.Fragment == "" && parsed.EscapedPath() == path {
+			if httpReq.URL.EscapedPath() != path {
+				t.Fatalf("encoding of %q not preserved, got %q", path, httpReq.URL.EscapedPath())
+			}
+		}
+
+		reparsed, err := url.Parse(httpReq.URL.String())
+		if err != nil {
+			t.Fatalf("could not parse generated URL %q: %v", httpReq.URL.String(), err)
+		}
+		if reparsed.Path != httpReq.URL.Path {
+			t.Fatalf("URL %q parses back to path %q, expected %q", httpReq.URL.String(), reparsed.Path, httpReq.URL.Path)
+		}
+		query, err := url.ParseQuery(reparsed.RawQuery)
+		if err != nil {
+			t.Fatalf("could not parse generated query %q: %v", reparsed.RawQuery, err)
+		}
+		if len(query[key]) != 1 || query[key][0] != value {
+			t.Fatalf("query %q=%q converted to %v", key, value, query[key])
+		}
+	})
+}
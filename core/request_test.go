@@ -3,9 +3,15 @@ package core_test
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"sync"
 
 	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/tencentyun/scf-go-lib/events"
@@ -57,6 +63,41 @@ var _ = Describe("RequestAccessor tests", func() {
 			Expect("2").To(Equal(query["world"][0]))
 		})
 
+		It("Keeps all values of multi-value query parameters", func() {
+			req := getProxyRequest("/hello", "GET")
+			req.QueryString = map[string][]string{
+				"id":    {"1", "2"},
+				"debug": {},
+				"q":     {"a b&c=d"},
+			}
+			httpReq, err := accessor.EventToRequestWithContext(context.Background(), req)
+			Expect(err).To(BeNil())
+
+			query := httpReq.URL.Query()
+			Expect(query["id"]).To(Equal([]string{"1", "2"}))
+			Expect(query).To(HaveKey("debug"))
+			Expect(query.Get("q")).To(Equal("a b&c=d"))
+		})
+
+		It("Preserves encoded slashes in the path", func() {
+			req := getProxyRequest("/files/a%2Fb", "GET")
+			httpReq, err := accessor.EventToRequestWithContext(context.Background(), req)
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/files/a/b"))
+			Expect(httpReq.URL.RawPath).To(Equal("/files/a%2Fb"))
+			Expect(httpReq.URL.EscapedPath()).To(Equal("/files/a%2Fb"))
+		})
+
+		It("Accepts paths with reserved and non-ASCII characters", func() {
+			for _, path := range []string{"/a b", "/a#b", "/a?b", "/café", "/100%"} {
+				req := getProxyRequest(path, "GET")
+				httpReq, err := accessor.EventToRequestWithContext(context.Background(), req)
+				Expect(err).To(BeNil())
+				Expect(httpReq.URL.Path).To(Equal(path))
+				Expect(httpReq.URL.RawQuery).To(Equal(""))
+				Expect(httpReq.URL.Fragment).To(Equal(""))
+			}
+		})
 	})
 
 	Context("StripBasePath tests", func() {
@@ -77,7 +118,207 @@ var _ = Describe("RequestAccessor tests", func() {
 		})
 	})
 
+	Context("Base path stripping", func() {
+		It("Only strips whole path segments", func() {
+			accessor := core.RequestAccessor{}
+			accessor.StripBasePath("/api")
+
+			httpReq, err := accessor.EventToRequestWithContext(context.Background(), getProxyRequest("/api/users", "GET"))
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/users"))
+
+			httpReq, err = accessor.EventToRequestWithContext(context.Background(), getProxyRequest("/apiv2/users", "GET"))
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/apiv2/users"))
+
+			httpReq, err = accessor.EventToRequestWithContext(context.Background(), getProxyRequest("/api", "GET"))
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/"))
+		})
+
+		It("Replaces the previous catch-all base path", func() {
+			accessor := core.RequestAccessor{}
+			accessor.StripBasePath("/v1")
+			accessor.StripBasePath("/v2")
+
+			httpReq, err := accessor.EventToRequest(getProxyRequest("/v1/users", "GET"))
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/v1/users"))
+
+			accessor.StripBasePath("")
+			httpReq, err = accessor.EventToRequest(getProxyRequest("/v2/users", "GET"))
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/v2/users"))
+		})
+
+		It("Selects the mapping by host and stage", func() {
+			accessor := core.RequestAccessor{}
+			accessor.StripBasePath("/default")
+			Expect(accessor.AddBasePathMapping(core.BasePathMapping{Host: "api.example.com:443", BasePath: "orders/"})).To(Equal("/orders"))
+			accessor.AddBasePathMapping(core.BasePathMapping{Stage: "test", BasePath: "/orders"})
+			accessor.AddBasePathMapping(core.BasePathMapping{Host: "api.example.com", Stage: "test", BasePath: "/orders/v2"})
+			Expect(accessor.AddBasePathMapping(core.BasePathMapping{Host: "ignored.example.com", BasePath: " "})).To(Equal(""))
+
+			req := getProxyRequest("/orders/v2/list", "GET")
+			req.Headers = map[string]string{"host": "API.example.com"}
+			req.Context.Stage = "prod"
+			httpReq, err := accessor.EventToRequest(req)
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/v2/list"))
+
+			req.Context.Stage = "test"
+			httpReq, err = accessor.EventToRequest(req)
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/list"))
+
+			req.Headers = map[string]string{"Host": "other.example.com"}
+			httpReq, err = accessor.EventToRequest(req)
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/v2/list"))
+
+			req.Context.Stage = "prod"
+			req.Path = "/default/list"
+			httpReq, err = accessor.EventToRequest(req)
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/list"))
+		})
+
+		It("Exposes the stripped base path to handlers", func() {
+			accessor := core.RequestAccessor{}
+			accessor.StripBasePath("/api")
+
+			httpReq, err := accessor.EventToRequestWithContext(context.Background(), getProxyRequest("/api/users", "GET"))
+			Expect(err).To(BeNil())
+			basePath, ok := core.GetBasePathFromContext(httpReq.Context())
+			Expect(ok).To(BeTrue())
+			Expect(basePath).To(Equal("/api"))
+			_, ok = core.GetAPIGatewayContextFromContext(httpReq.Context())
+			Expect(ok).To(BeTrue())
+
+			httpReq, err = accessor.ProxyEventToHTTPRequest(getProxyRequest("/api/users", "GET"))
+			Expect(err).To(BeNil())
+			basePath, ok = core.GetBasePathFromContext(httpReq.Context())
+			Expect(ok).To(BeTrue())
+			Expect(basePath).To(Equal("/api"))
+
+			httpReq, err = accessor.EventToRequestWithContext(context.Background(), getProxyRequest("/users", "GET"))
+			Expect(err).To(BeNil())
+			_, ok = core.GetBasePathFromContext(httpReq.Context())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("Concurrent invocations", func() {
+		It("Serves parallel events without sharing state", func() {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				apiGwContext, _ := core.GetAPIGatewayContextFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(r.URL.Path + "?" + r.URL.Query().Get("id") + ":" + apiGwContext.RequestID))
+			})
+			accessor := core.NewRequestAccessor(core.WithBasePath("/api"))
+
+			const invocations = 500
+			var wg sync.WaitGroup
+			errs := make(chan error, invocations)
+			for i := 0; i < invocations; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					id := strconv.Itoa(i)
+					req := coretest.NewEvent("GET", "/api/echo").Query("id", id).RequestID(id).Stage("prod").Build()
+					resp, err := accessor.ServeEventWithContext(context.Background(), handler, req)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if resp.StatusCode != http.StatusOK || resp.Body != "/echo?"+id+":"+id {
+						errs <- fmt.Errorf("invocation %s got %d %q", id, resp.StatusCode, resp.Body)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				Expect(err).To(BeNil())
+			}
+		})
+	})
+
+	Context("Accessor options", func() {
+		It("Applies base path options at construction", func() {
+			accessor := core.NewRequestAccessor(
+				core.WithBasePath("api"),
+				core.WithBasePathMapping(core.BasePathMapping{Stage: "test", BasePath: "/test/api"}),
+			)
+
+			httpReq, err := accessor.EventToRequest(getProxyRequest("/api/users", "GET"))
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/users"))
+
+			req := getProxyRequest("/test/api/users", "GET")
+			req.Context.Stage = "test"
+			httpReq, err = accessor.EventToRequest(req)
+			Expect(err).To(BeNil())
+			Expect(httpReq.URL.Path).To(Equal("/users"))
+		})
+
+		It("Serves events with the configured trailer policy", func() {
+			accessor := core.NewRequestAccessor(core.WithTrailerPolicy(core.TrailersDrop))
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+				w.Write([]byte("ok"))
+			})
+
+			resp, err := accessor.ServeEventWithContext(context.Background(), handler, getProxyRequest("/", "GET"))
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Headers).ToNot(HaveKey("X-Checksum"))
+
+			resp, err = core.NewRequestAccessor().ServeEvent(handler, getProxyRequest("/", "GET"))
+			Expect(err).To(BeNil())
+			Expect(resp.Headers["X-Checksum"]).To(Equal("abc"))
+		})
+	})
+
 	Context("Retrieves API Gateway context", func() {
+		It("Encodes the context header like encoding/json", func() {
+			secret := "AKID<&>\"é"
+			for _, rc := range []events.APIGatewayRequestContext{
+				getRequestContext(),
+				{ServiceID: "service-\u2028", RequestID: "a\"b\\c", Method: "GET", Path: "/a?b=<c>&d", SourceIP: "::1", Stage: "\xff"},
+			} {
+				for _, id := range []*string{nil, &secret} {
+					rc.Identity.SecretID = id
+					event := getProxyRequest("/", "GET")
+					event.Context = rc
+					httpReq, err := (&core.RequestAccessor{}).ProxyEventToHTTPRequest(event)
+					Expect(err).To(BeNil())
+					expected, err := json.Marshal(rc)
+					Expect(err).To(BeNil())
+					Expect(httpReq.Header.Get(core.APIGwContextHeader)).To(Equal(string(expected)))
+				}
+			}
+		})
+
+		It("Does not leak response state between invocations", func() {
+			accessor := core.NewRequestAccessor()
+			first := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-First", "1")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("first"))
+			})
+			second := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("second"))
+			})
+			_, err := accessor.ServeEvent(first, getProxyRequest("/", "GET"))
+			Expect(err).To(BeNil())
+			resp, err := accessor.ServeEvent(second, getProxyRequest("/", "GET"))
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Headers).ToNot(HaveKey("X-First"))
+			Expect(resp.Body).To(Equal("second"))
+		})
+
 		It("Returns a correctly unmarshalled object", func() {
 			contextRequest := getProxyRequest("orders", "GET")
 			contextRequest.Context = getRequestContext()
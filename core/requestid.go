@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"strings"
+
+	"github.com/tencentyun/scf-go-lib/events"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+// DefaultRequestIDHeader is the response header used by WithRequestIDHeader
+// when no header name is given.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// RequestIDSource identifies where the request ID echoed in responses
+// comes from.
+type RequestIDSource int
+
+const (
+	// RequestIDGateway is the API Gateway request ID of the event.
+	RequestIDGateway RequestIDSource = iota
+	// RequestIDFunction is the request ID of the function invocation.
+	RequestIDFunction
+	// RequestIDInbound is the value of the request ID header sent by the
+	// client, for example an X-Request-Id set by an upstream proxy.
+	RequestIDInbound
+)
+
+type requestIDConfig struct {
+	header  string
+	sources []RequestIDSource
+}
+
+// WithRequestIDHeader sets a request ID header on every response, including
+// the error responses generated by the library, so clients can quote it
+// when they report a problem. The sources are tried in order and the first
+// non-empty value is used; the default is RequestIDGateway alone. An empty
+// header name means DefaultRequestIDHeader. A header already set by the
+// handler is left untouched.
+func WithRequestIDHeader(header string, sources ...RequestIDSource) Option {
+	return func(c *config) {
+		if header == "" {
+			header = DefaultRequestIDHeader
+		}
+		if len(sources) == 0 {
+			sources = []RequestIDSource{RequestIDGateway}
+		}
+		c.requestID = &requestIDConfig{header: header, sources: sources}
+	}
+}
+
+func (r *requestIDConfig) value(ctx context.Context, req events.APIGatewayRequest) string {
+	for _, source := range r.sources {
+		var id string
+		switch source {
+		case RequestIDGateway:
+			id = req.Context.RequestID
+		case RequestIDFunction:
+			if lc, ok := functioncontext.FromContext(ctx); ok && lc != nil {
+				id = lc.RequestID
+			}
+		case RequestIDInbound:
+			id = eventHeader(req, r.header)
+		}
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func (r *requestIDConfig) decorate(ctx context.Context, req events.APIGatewayRequest, resp *events.APIGatewayResponse) {
+	if _, ok := responseHeader(*resp, r.header); ok {
+		return
+	}
+	id := r.value(ctx, req)
+	if id == "" {
+		return
+	}
+	setResponseHeader(resp, r.header, id)
+}
+
+// setResponseHeader sets a header on a proxy response, replacing any value
+// the handler set under a different capitalization.
+func setResponseHeader(resp *events.APIGatewayResponse, name string, value string) {
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	for k := range resp.Headers {
+		if k != name && strings.EqualFold(k, name) {
+			delete(resp.Headers, k)
+		}
+	}
+	resp.Headers[name] = value
+}
+
+// responseHeader looks up a header of a proxy response ignoring the case
+// of its name.
+func responseHeader(resp events.APIGatewayResponse, name string) (string, bool) {
+	if v, ok := resp.Headers[name]; ok {
+		return v, true
+	}
+	for k, v := range resp.Headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,64 @@
+package core_test
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+)
+
+var _ = Describe("Request ID header tests", func() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	ctx := functioncontext.NewContext(context.Background(), &functioncontext.FunctionContext{RequestID: "fn-1"})
+
+	It("Echoes the API Gateway request ID by default", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestIDHeader(""))
+		req := coretest.NewEvent("GET", "/").Build()
+		req.Context = getRequestContext()
+		resp, err := accessor.ServeEventWithContext(ctx, handler, req)
+		Expect(err).To(BeNil())
+		Expect(resp.Headers[core.DefaultRequestIDHeader]).To(Equal("x"))
+	})
+
+	It("Prefers the configured sources in order", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestIDHeader("X-Trace-Id", core.RequestIDInbound, core.RequestIDFunction))
+		req := coretest.NewEvent("GET", "/").Build()
+		resp, err := accessor.ServeEventWithContext(ctx, handler, req)
+		Expect(err).To(BeNil())
+		Expect(resp.Headers["X-Trace-Id"]).To(Equal("fn-1"))
+
+		req.Headers = map[string]string{"x-trace-id": "client-1"}
+		resp, err = accessor.ServeEventWithContext(ctx, handler, req)
+		Expect(err).To(BeNil())
+		Expect(resp.Headers["X-Trace-Id"]).To(Equal("client-1"))
+	})
+
+	It("Decorates error responses generated by the library", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestIDHeader("", core.RequestIDGateway))
+		req := coretest.NewEvent("BAD METHOD", "/").Build()
+		req.Context = getRequestContext()
+		resp, err := accessor.ServeEvent(handler, req)
+		Expect(err).ToNot(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusGatewayTimeout))
+		Expect(resp.Headers[core.DefaultRequestIDHeader]).To(Equal("x"))
+	})
+
+	It("Keeps a request ID set by the handler", func() {
+		accessor := core.NewRequestAccessor(core.WithRequestIDHeader(""))
+		req := coretest.NewEvent("GET", "/").Build()
+		req.Context = getRequestContext()
+		resp, err := accessor.ServeEvent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-ID", "handler")
+			w.WriteHeader(http.StatusNoContent)
+		}), req)
+		Expect(err).To(BeNil())
+		Expect(resp.Headers).To(HaveLen(1))
+		Expect(resp.Headers["X-Request-Id"]).To(Equal("handler"))
+	})
+})
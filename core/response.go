@@ -3,10 +3,18 @@
 package core
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/tencentyun/scf-go-lib/events"
@@ -15,12 +23,45 @@ import (
 const defaultStatusCode = -1
 const contentTypeHeaderKey = "Content-Type"
 
+// sniffLen is the number of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// ErrHijackNotSupported is returned by ProxyResponseWriter.Hijack. The response
+// is buffered and returned to API Gateway as a single event, so there is no
+// connection to take over.
+var ErrHijackNotSupported = errors.New("core: ProxyResponseWriter cannot be hijacked, API Gateway responses are buffered events")
+
+// ErrPushNotSupported is returned by ProxyResponseWriter.Push. It wraps
+// http.ErrNotSupported so callers can test for either value.
+var ErrPushNotSupported = fmt.Errorf("core: HTTP/2 server push is not available through API Gateway: %w", http.ErrNotSupported)
+
+// TrailerPolicy tells a ProxyResponseWriter what to do with HTTP trailers.
+// API Gateway responses have no trailer section, so trailers can only be
+// delivered as regular headers or not at all.
+type TrailerPolicy int
+
+const (
+	// TrailersMerge adds trailer values to the response headers. This is the
+	// default policy.
+	TrailersMerge TrailerPolicy = iota
+	// TrailersDrop removes trailers from the response and logs a warning.
+	TrailersDrop
+)
+
 // ProxyResponseWriter implements http.ResponseWriter and adds the method
-// necessary to return an events.APIGatewayProxyResponse object
+// necessary to return an events.APIGatewayProxyResponse object.
+//
+// Besides the basic interface it implements the optional interfaces that
+// frameworks probe for: http.Flusher, http.CloseNotifier, io.StringWriter,
+// io.ReaderFrom and the deadline methods used by http.ResponseController.
+// http.Hijacker and http.Pusher are implemented but always refuse with
+// ErrHijackNotSupported and ErrPushNotSupported.
 type ProxyResponseWriter struct {
-	headers http.Header
-	body    bytes.Buffer
-	status  int
+	headers       http.Header
+	body          bytes.Buffer
+	status        int
+	closeNotify   chan bool
+	trailerPolicy TrailerPolicy
 }
 
 // NewProxyResponseWriter returns a new ProxyResponseWriter object.
@@ -34,6 +75,45 @@ func NewProxyResponseWriter() *ProxyResponseWriter {
 
 }
 
+// maxPooledBodySize is the largest body buffer kept for reuse, so that a
+// few large responses do not pin their memory for the life of the instance.
+const maxPooledBodySize = 64 << 10
+
+var responseWriterPool = sync.Pool{
+	New: func() interface{} { return NewProxyResponseWriter() },
+}
+
+// acquireResponseWriter returns an empty ProxyResponseWriter from the pool.
+func acquireResponseWriter(policy TrailerPolicy) *ProxyResponseWriter {
+	w := responseWriterPool.Get().(*ProxyResponseWriter)
+	w.trailerPolicy = policy
+	return w
+}
+
+// releaseResponseWriter resets w and returns it to the pool. w must not be
+// used afterwards, the handler it was given to has returned and
+// GetProxyResponse copied everything out of it.
+func releaseResponseWriter(w *ProxyResponseWriter) {
+	if w.body.Cap() > maxPooledBodySize {
+		return
+	}
+	for k := range w.headers {
+		delete(w.headers, k)
+	}
+	w.body.Reset()
+	w.status = defaultStatusCode
+	w.closeNotify = nil
+	w.trailerPolicy = TrailersMerge
+	responseWriterPool.Put(w)
+}
+
+// SetTrailerPolicy changes how trailers are handled by GetProxyResponse.
+// Trailers are either announced with the "Trailer" header and set after the
+// body is written, or set at any time with the http.TrailerPrefix prefix.
+func (r *ProxyResponseWriter) SetTrailerPolicy(policy TrailerPolicy) {
+	r.trailerPolicy = policy
+}
+
 // Header implementation from the http.ResponseWriter interface.
 func (r *ProxyResponseWriter) Header() http.Header {
 	return r.headers
@@ -43,7 +123,43 @@ func (r *ProxyResponseWriter) Header() http.Header {
 // was set before with the WriteHeader method it sets the status
 // for the response to 200 OK.
 func (r *ProxyResponseWriter) Write(body []byte) (int, error) {
-	if r.status == -1 {
+	r.prepareWrite(body)
+	return (&r.body).Write(body)
+}
+
+// WriteString implements io.StringWriter. It behaves like Write.
+func (r *ProxyResponseWriter) WriteString(s string) (int, error) {
+	if r.status == defaultStatusCode || r.Header().Get(contentTypeHeaderKey) == "" {
+		return r.Write([]byte(s))
+	}
+	return (&r.body).WriteString(s)
+}
+
+// ReadFrom implements io.ReaderFrom so that io.Copy and http.ServeContent
+// stream straight into the response buffer. When no content type is set
+// the first bytes read are used to detect one, as Write does.
+func (r *ProxyResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	if r.status == defaultStatusCode || r.Header().Get(contentTypeHeaderKey) == "" {
+		head := make([]byte, sniffLen)
+		read, err := io.ReadFull(src, head)
+		written, _ := r.Write(head[:read])
+		n += int64(written)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	read, err := (&r.body).ReadFrom(src)
+	return n + read, err
+}
+
+// prepareWrite defaults the status to 200 OK and, when it is missing,
+// detects the content type from the first chunk of the body.
+func (r *ProxyResponseWriter) prepareWrite(body []byte) {
+	if r.status == defaultStatusCode {
 		r.status = http.StatusOK
 	}
 
@@ -54,8 +170,6 @@ func (r *ProxyResponseWriter) Write(body []byte) (int, error) {
 	if r.Header().Get(contentTypeHeaderKey) == "" {
 		r.Header().Add(contentTypeHeaderKey, http.DetectContentType(body))
 	}
-
-	return (&r.body).Write(body)
 }
 
 // WriteHeader sets a status code for the response. This method is used
@@ -85,10 +199,15 @@ func (r *ProxyResponseWriter) GetProxyResponse() (events.APIGatewayResponse, err
 		isBase64 = true
 	}
 
-	headers := map[string]string{}
+	headers := make(map[string]string, len(r.headers))
 	for k, v := range r.headers {
+		if len(v) == 0 || k == "Trailer" || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
 		headers[k] = v[0]
 	}
+	r.applyTrailers(headers)
+
 	return events.APIGatewayResponse{
 		StatusCode:      r.status,
 		Headers:         headers,
@@ -97,7 +216,93 @@ func (r *ProxyResponseWriter) GetProxyResponse() (events.APIGatewayResponse, err
 	}, nil
 }
 
-//Flush flush
+// applyTrailers merges or drops the declared and prefixed trailers according
+// to the trailer policy. Prefixed keys never reach the output as literal names.
+func (r *ProxyResponseWriter) applyTrailers(headers map[string]string) {
+	trailers := map[string]string{}
+	for _, declared := range r.headers["Trailer"] {
+		for _, name := range strings.Split(declared, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if v := r.headers[name]; len(v) > 0 {
+				trailers[name] = v[0]
+			} else {
+				trailers[name] = ""
+			}
+		}
+	}
+	for k, v := range r.headers {
+		if !strings.HasPrefix(k, http.TrailerPrefix) || len(v) == 0 {
+			continue
+		}
+		trailers[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = v[0]
+	}
+	if len(trailers) == 0 {
+		return
+	}
+
+	for name, value := range trailers {
+		if r.trailerPolicy == TrailersDrop {
+			delete(headers, name)
+			continue
+		}
+		if value != "" {
+			headers[name] = value
+		}
+	}
+	if r.trailerPolicy == TrailersDrop {
+		log.Printf("Dropping %d response trailer(s), API Gateway responses do not support trailers\n", len(trailers))
+	}
+}
+
+// Flush implements http.Flusher. The response is sent to API Gateway as a
+// whole once the handler returns, so flushing is a no-op.
 func (r *ProxyResponseWriter) Flush() {
-	return
+}
+
+// FlushError is the http.ResponseController flavour of Flush. It never fails.
+func (r *ProxyResponseWriter) FlushError() error {
+	return nil
+}
+
+// Hijack implements http.Hijacker and always returns ErrHijackNotSupported.
+func (r *ProxyResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, ErrHijackNotSupported
+}
+
+// Push implements http.Pusher and always returns ErrPushNotSupported.
+func (r *ProxyResponseWriter) Push(target string, opts *http.PushOptions) error {
+	return ErrPushNotSupported
+}
+
+// CloseNotify implements http.CloseNotifier. API Gateway does not tell the
+// function when a client goes away, so the returned channel never fires;
+// handlers should watch the request context instead.
+func (r *ProxyResponseWriter) CloseNotify() <-chan bool {
+	if r.closeNotify == nil {
+		r.closeNotify = make(chan bool, 1)
+	}
+	return r.closeNotify
+}
+
+// SetReadDeadline is called by http.ResponseController. The request body is
+// already in memory, so reads never block and the deadline is ignored.
+func (r *ProxyResponseWriter) SetReadDeadline(deadline time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is called by http.ResponseController. Writes go to an
+// in-memory buffer and never block, so the deadline is ignored. The overall
+// invocation is still bound by the function timeout.
+func (r *ProxyResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	return nil
+}
+
+// EnableFullDuplex is called by http.ResponseController. The request body is
+// fully buffered before the handler runs, so reading it while writing the
+// response is always allowed.
+func (r *ProxyResponseWriter) EnableFullDuplex() error {
+	return nil
 }
@@ -1,10 +1,15 @@
 package core
 
 import (
+	"bytes"
 	"encoding/base64"
+	"errors"
+	"io"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -159,4 +164,147 @@ var _ = Describe("ResponseWriter tests", func() {
 
 	})
 
+	Context("Handle trailers", func() {
+		It("Merges declared trailers into the headers", func() {
+			response := NewProxyResponseWriter()
+			response.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+			response.Header().Set("Content-Type", "application/grpc-web")
+			response.Write([]byte("data"))
+			response.Header().Set("Grpc-Status", "0")
+
+			proxyResponse, err := response.GetProxyResponse()
+			Expect(err).To(BeNil())
+			Expect(proxyResponse.Headers["Grpc-Status"]).To(Equal("0"))
+			_, ok := proxyResponse.Headers["Grpc-Message"]
+			Expect(ok).To(BeFalse())
+			_, ok = proxyResponse.Headers["Trailer"]
+			Expect(ok).To(BeFalse())
+		})
+
+		It("Strips the trailer prefix from undeclared trailers", func() {
+			response := NewProxyResponseWriter()
+			response.Write([]byte("data"))
+			response.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+
+			proxyResponse, err := response.GetProxyResponse()
+			Expect(err).To(BeNil())
+			Expect(proxyResponse.Headers["X-Checksum"]).To(Equal("abc"))
+			for k := range proxyResponse.Headers {
+				Expect(strings.HasPrefix(k, http.TrailerPrefix)).To(BeFalse())
+			}
+		})
+
+		It("Drops trailers when asked to", func() {
+			response := NewProxyResponseWriter()
+			response.SetTrailerPolicy(TrailersDrop)
+			response.Header().Set("Trailer", "Grpc-Status")
+			response.Write([]byte("data"))
+			response.Header().Set("Grpc-Status", "0")
+			response.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+
+			proxyResponse, err := response.GetProxyResponse()
+			Expect(err).To(BeNil())
+			Expect(proxyResponse.Headers).To(HaveLen(1))
+			Expect(proxyResponse.Headers).To(HaveKey("Content-Type"))
+		})
+	})
+
+	Context("Optional ResponseWriter interfaces", func() {
+		It("Implements the interfaces frameworks probe for", func() {
+			var w http.ResponseWriter = NewProxyResponseWriter()
+			_, ok := w.(http.Flusher)
+			Expect(ok).To(BeTrue())
+			_, ok = w.(http.Hijacker)
+			Expect(ok).To(BeTrue())
+			_, ok = w.(http.Pusher)
+			Expect(ok).To(BeTrue())
+			_, ok = w.(http.CloseNotifier)
+			Expect(ok).To(BeTrue())
+			_, ok = w.(io.StringWriter)
+			Expect(ok).To(BeTrue())
+			_, ok = w.(io.ReaderFrom)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("Refuses hijacking and server push", func() {
+			response := NewProxyResponseWriter()
+			conn, rw, err := response.Hijack()
+			Expect(conn).To(BeNil())
+			Expect(rw).To(BeNil())
+			Expect(err).To(Equal(ErrHijackNotSupported))
+
+			err = response.Push("/style.css", nil)
+			Expect(errors.Is(err, http.ErrNotSupported)).To(BeTrue())
+		})
+
+		It("Writes strings like byte slices", func() {
+			response := NewProxyResponseWriter()
+			written, err := response.WriteString("<html><body>hi</body></html>")
+			Expect(err).To(BeNil())
+			Expect(written).To(Equal(28))
+			response.WriteString("!")
+			Expect(strings.HasPrefix(response.Header().Get("Content-Type"), "text/html")).To(BeTrue())
+
+			proxyResponse, err := response.GetProxyResponse()
+			Expect(err).To(BeNil())
+			Expect(proxyResponse.StatusCode).To(Equal(http.StatusOK))
+			Expect(proxyResponse.Body).To(Equal("<html><body>hi</body></html>!"))
+		})
+
+		It("Reads bodies through io.Copy and sniffs the content type", func() {
+			body := strings.Repeat("<html><body>large</body></html>", 100)
+			response := NewProxyResponseWriter()
+			copied, err := io.Copy(response, strings.NewReader(body))
+			Expect(err).To(BeNil())
+			Expect(copied).To(Equal(int64(len(body))))
+			Expect(strings.HasPrefix(response.Header().Get("Content-Type"), "text/html")).To(BeTrue())
+
+			proxyResponse, err := response.GetProxyResponse()
+			Expect(err).To(BeNil())
+			Expect(proxyResponse.StatusCode).To(Equal(http.StatusOK))
+			Expect(proxyResponse.Body).To(Equal(body))
+		})
+
+		It("Serves content with http.ServeContent", func() {
+			response := NewProxyResponseWriter()
+			req := httptest.NewRequest("GET", "/file.txt", nil)
+			http.ServeContent(response, req, "file.txt", time.Time{}, bytes.NewReader([]byte("file content")))
+
+			proxyResponse, err := response.GetProxyResponse()
+			Expect(err).To(BeNil())
+			Expect(proxyResponse.StatusCode).To(Equal(http.StatusOK))
+			Expect(proxyResponse.Body).To(Equal("file content"))
+			Expect(strings.HasPrefix(proxyResponse.Headers["Content-Type"], "text/plain")).To(BeTrue())
+		})
+
+		It("Supports http.ResponseController through wrapping writers", func() {
+			response := NewProxyResponseWriter()
+			rc := http.NewResponseController(&unwrappingWriter{response})
+			Expect(rc.SetWriteDeadline(time.Now().Add(time.Second))).To(BeNil())
+			Expect(rc.SetReadDeadline(time.Now().Add(time.Second))).To(BeNil())
+			Expect(rc.EnableFullDuplex()).To(BeNil())
+			Expect(rc.Flush()).To(BeNil())
+			_, _, err := rc.Hijack()
+			Expect(err).To(Equal(ErrHijackNotSupported))
+		})
+
+		It("Returns a close notification channel that never fires", func() {
+			response := NewProxyResponseWriter()
+			ch := response.CloseNotify()
+			Expect(ch).ToNot(BeNil())
+			Expect(response.CloseNotify()).To(Equal(ch))
+			Consistently(ch, 10*time.Millisecond).ShouldNot(Receive())
+		})
+	})
+
 })
+
+// unwrappingWriter mimics framework response writers that expose the
+// underlying writer through Unwrap.
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (u *unwrappingWriter) Unwrap() http.ResponseWriter {
+	return u.ResponseWriter
+}
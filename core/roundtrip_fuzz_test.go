@@ -0,0 +1,193 @@
+package core_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/linthan/scf-go-api-proxy/conformance"
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// goldenFixtures loads the conformance fixtures used to seed the corpus.
+func goldenFixtures(f *testing.F) []conformance.Fixture {
+	fixtures, err := conformance.Fixtures()
+	if err != nil {
+		f.Fatalf("could not load golden fixtures: %v", err)
+	}
+	return fixtures
+}
+
+func FuzzEventRoundTrip(f *testing.F) {
+	for _, fixture := range goldenFixtures(f) {
+		req := fixture.Request
+		headerKey, headerValue := "", ""
+		for k, v := range req.Headers {
+			if !strings.EqualFold(k, core.Base64EncodedHeader) {
+				headerKey, headerValue = k, v
+				break
+			}
+		}
+		queryKey, queryValue := "", ""
+		for k, v := range req.QueryString {
+			queryKey = k
+			if len(v) > 0 {
+				queryValue = v[0]
+			}
+			break
+		}
+		body, isBase64 := []byte(req.Body), eventHeaderValue(req, core.Base64EncodedHeader) == "true"
+		if isBase64 {
+			if decoded, err := base64.StdEncoding.DecodeString(req.Body); err == nil {
+				body = decoded
+			}
+		}
+		f.Add(req.Method, req.Path, headerKey, headerValue, queryKey, queryValue, body, isBase64)
+	}
+
+	f.Fuzz(func(t *testing.T, method, path, headerKey, headerValue, queryKey, queryValue string, body []byte, isBase64 bool) {
+		accessor := core.RequestAccessor{}
+		event := events.APIGatewayRequest{
+			Method:      method,
+			Path:        path,
+			Headers:     map[string]string{},
+			QueryString: events.APIGatewayQueryString{queryKey: {queryValue}},
+			Body:        string(body),
+		}
+		if headerKey != "" {
+			event.Headers[headerKey] = headerValue
+		}
+		if isBase64 {
+			core.SetBinaryEventBody(&event, body)
+		}
+
+		first, err := accessor.EventToRequest(event)
+		if err != nil {
+			return
+		}
+		firstBody := readBody(t, first)
+		first.Body = io.NopCloser(bytes.NewReader(firstBody))
+		if isBase64 && !bytes.Equal(firstBody, body) {
+			t.Fatalf("base64 body decoded to %q, expected %q", firstBody, body)
+		}
+
+		roundTrip, err := core.RequestToEvent(first)
+		if err != nil {
+			t.Fatalf("could not convert request back to an event: %v", err)
+		}
+		second, err := accessor.EventToRequest(roundTrip)
+		if err != nil {
+			t.Fatalf("could not convert round tripped event %+v: %v", roundTrip, err)
+		}
+
+		if second.Method != first.Method {
+			t.Fatalf("method %q round tripped to %q", first.Method, second.Method)
+		}
+		if second.URL.Path != first.URL.Path || second.URL.EscapedPath() != first.URL.EscapedPath() {
+			t.Fatalf("path %q round tripped to %q", first.URL.EscapedPath(), second.URL.EscapedPath())
+		}
+		if !reflect.DeepEqual(second.URL.Query(), first.URL.Query()) {
+			t.Fatalf("query %v round tripped to %v", first.URL.Query(), second.URL.Query())
+		}
+		if secondBody := readBody(t, second); !bytes.Equal(secondBody, firstBody) {
+			t.Fatalf("body %q round tripped to %q", firstBody, secondBody)
+		}
+		if utf8.Valid(firstBody) == (eventHeaderValue(roundTrip, core.Base64EncodedHeader) != "") {
+			t.Fatalf("base64 encoding of body %q not marked correctly", firstBody)
+		}
+		if headerKey != "" && !isGatewayHeader(headerKey) {
+			if got, want := second.Header.Values(headerKey), first.Header.Values(headerKey); strings.Join(got, ", ") != strings.Join(want, ", ") {
+				t.Fatalf("header %q: %q round tripped to %q", headerKey, want, got)
+			}
+		}
+	})
+}
+
+func FuzzProxyResponseRoundTrip(f *testing.F) {
+	for _, fixture := range goldenFixtures(f) {
+		resp := fixture.Response
+		body := []byte(resp.Body)
+		if resp.IsBase64Encoded {
+			if decoded, err := base64.StdEncoding.DecodeString(resp.Body); err == nil {
+				body = decoded
+			}
+		}
+		f.Add(resp.StatusCode, resp.Headers["Content-Type"], body)
+	}
+
+	f.Fuzz(func(t *testing.T, status int, contentType string, body []byte) {
+		writer := core.NewProxyResponseWriter()
+		if contentType != "" {
+			writer.Header().Set("Content-Type", contentType)
+		}
+		if status >= 100 && status <= 999 {
+			writer.WriteHeader(status)
+		}
+		if _, err := writer.Write(body); err != nil {
+			t.Fatalf("could not write body: %v", err)
+		}
+
+		proxyResponse, err := writer.GetProxyResponse()
+		if err != nil {
+			return
+		}
+		if proxyResponse.IsBase64Encoded == utf8.Valid(body) {
+			t.Fatalf("base64 encoding of body %q decided wrongly", body)
+		}
+
+		resp, err := core.EventToResponse(proxyResponse)
+		if err != nil {
+			t.Fatalf("could not convert proxy response %+v: %v", proxyResponse, err)
+		}
+		decoded, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("could not read response body: %v", err)
+		}
+		if !bytes.Equal(decoded, body) || resp.ContentLength != int64(len(body)) {
+			t.Fatalf("body %q converted to %q", body, decoded)
+		}
+		if resp.StatusCode != proxyResponse.StatusCode {
+			t.Fatalf("status %d converted to %d", proxyResponse.StatusCode, resp.StatusCode)
+		}
+
+		recorder := httptest.NewRecorder()
+		if err := core.WriteProxyResponse(recorder, proxyResponse); err != nil {
+			t.Fatalf("could not replay proxy response: %v", err)
+		}
+		if code := proxyResponse.StatusCode; code == http.StatusNoContent || code == http.StatusNotModified || code < 200 {
+			body = nil
+		}
+		if !bytes.Equal(recorder.Body.Bytes(), body) {
+			t.Fatalf("body %q replayed as %q", body, recorder.Body.Bytes())
+		}
+	})
+}
+
+func readBody(t *testing.T, req *http.Request) []byte {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("could not read request body: %v", err)
+	}
+	return body
+}
+
+func eventHeaderValue(req events.APIGatewayRequest, name string) string {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func isGatewayHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	return strings.HasPrefix(name, "X-Apigateway-") || name == http.CanonicalHeaderKey(core.Base64EncodedHeader) || name == "X-Forwarded-For"
+}
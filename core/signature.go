@@ -0,0 +1,269 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// Key pair signature algorithms supported by WithKeySignature.
+const (
+	KeySignatureHMACSHA1   = "hmac-sha1"
+	KeySignatureHMACSHA256 = "hmac-sha256"
+)
+
+// DefaultKeySignatureMaxSkew is how far the signed date of a request can be
+// from the time of the function, as API Gateway allows.
+const DefaultKeySignatureMaxSkew = 15 * time.Minute
+
+// SecretKeySource returns the secret key of an API Gateway key pair.
+type SecretKeySource interface {
+	// SecretKey returns the secret key of the secret ID, and false when the
+	// key pair is unknown. Errors are reported as a failure to load the
+	// keys, not as an invalid signature.
+	SecretKey(ctx context.Context, secretID string) (string, bool, error)
+}
+
+type staticSecretKeys map[string]string
+
+// StaticSecretKeys returns a SecretKeySource with a fixed set of key pairs,
+// secret keys by secret ID.
+func StaticSecretKeys(keys map[string]string) SecretKeySource {
+	s := make(staticSecretKeys, len(keys))
+	for id, key := range keys {
+		s[id] = key
+	}
+	return s
+}
+
+func (s staticSecretKeys) SecretKey(ctx context.Context, secretID string) (string, bool, error) {
+	key, ok := s[secretID]
+	return key, ok, nil
+}
+
+// KeySignatureConfig configures WithKeySignature.
+type KeySignatureConfig struct {
+	// Keys returns the secret keys of the key pairs. It is required.
+	Keys SecretKeySource
+	// MaxSkew is how far the signed date can be from now,
+	// DefaultKeySignatureMaxSkew when it is zero.
+	MaxSkew time.Duration
+	// Exclude lists the path prefixes served without a signature.
+	Exclude []string
+}
+
+type keySignature struct {
+	keys    SecretKeySource
+	maxSkew time.Duration
+	exclude []string
+}
+
+// WithKeySignature verifies the API Gateway key pair authentication of every
+// request in the function, for APIs whose gateway does not check it, such
+// as "no auth" test stages. The client signs the X-Date or Date header, and
+// the other headers it lists, with the secret key:
+//
+//	Authorization: hmac id="<secret ID>", algorithm="hmac-sha1", headers="x-date source", signature="<base64 HMAC>"
+//
+// Unsigned requests, unknown key pairs, invalid signatures and dates more
+// than MaxSkew away get 401 Unauthorized before the framework runs. When the
+// request context carries the identity verified by the gateway, its secret
+// ID must be the one that signed the request. When the keys cannot be
+// loaded the request gets 503 Service Unavailable and the proxy returns the
+// error.
+//
+// The signature only covers the headers the client lists, usually the
+// date and Source: not the method, the path, the query or the body. It
+// proves the request was signed with the key in the last MaxSkew, not that
+// this request was; anyone who captures one signed request can replay its
+// headers on any endpoint until the date goes stale. Serve the API over
+// HTTPS, keep MaxSkew short, and do not rely on the signature alone to
+// authorize requests with side effects.
+//
+// The signature takes the Authorization header, so WithJWTAuth can only be
+// combined with it when the config names a cookie to read the token from.
+//
+// The verified secret ID is stored in the request context, read it with
+// GetVerifiedSecretIDFromContext. CORS preflights and the excluded paths
+// are not verified. A path is only excluded when its decoded, escaped and
+// cleaned forms all are, see WithJWTAuth.
+//
+// WithKeySignature panics if the config has no keys.
+func WithKeySignature(cfg KeySignatureConfig) Option {
+	if cfg.Keys == nil {
+		panic("core: WithKeySignature requires keys")
+	}
+	s := &keySignature{keys: cfg.Keys, maxSkew: cfg.MaxSkew}
+	if s.maxSkew <= 0 {
+		s.maxSkew = DefaultKeySignatureMaxSkew
+	}
+	for _, prefix := range cfg.Exclude {
+		s.exclude = append(s.exclude, normalizeBasePath(prefix))
+	}
+	return func(c *config) {
+		c.keySignature = s
+	}
+}
+
+// errInvalidSignature is wrapped by the errors of requests whose signature
+// cannot be accepted, as opposed to the errors loading the keys.
+var errInvalidSignature = errors.New("invalid signature")
+
+func invalidSignature(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", errInvalidSignature, fmt.Sprintf(format, a...))
+}
+
+// keySignatureChallenge is the WWW-Authenticate header of refused requests.
+const keySignatureChallenge = `hmac realm="api", headers="x-date source"`
+
+// authenticate verifies the signature of the event. It returns the response
+// refusing the request, or the secret ID when the request may go on; the
+// secret ID is empty when the path is excluded.
+func (s *keySignature) authenticate(ctx context.Context, c *config, req events.APIGatewayRequest) (string, *events.APIGatewayResponse, error) {
+	if excludedPath(c, req, s.exclude) {
+		return "", nil, nil
+	}
+	secretID, err := s.verify(ctx, req, time.Now())
+	if errors.Is(err, errInvalidSignature) {
+		resp := Unauthorized(keySignatureChallenge)
+		return "", &resp, nil
+	}
+	if err != nil {
+		resp := ServiceUnavailable()
+		return "", &resp, NewLoggedError("Could not load the API Gateway secret keys: %v", err)
+	}
+	return secretID, nil, nil
+}
+
+// verify checks the Authorization header of the event and returns the
+// secret ID that signed it.
+func (s *keySignature) verify(ctx context.Context, req events.APIGatewayRequest, now time.Time) (string, error) {
+	params, err := parseKeySignature(eventHeader(req, "Authorization"))
+	if err != nil {
+		return "", err
+	}
+	secretID, signature := params["id"], params["signature"]
+	if secretID == "" || signature == "" {
+		return "", invalidSignature("missing id or signature")
+	}
+	if identity := req.Context.Identity.SecretID; identity != nil && *identity != "" && *identity != secretID {
+		return "", invalidSignature("signed by %q, gateway identity is %q", secretID, *identity)
+	}
+	newHash, err := keySignatureHash(params["algorithm"])
+	if err != nil {
+		return "", err
+	}
+
+	names := strings.Fields(strings.ToLower(params["headers"]))
+	if len(names) == 0 {
+		return "", invalidSignature("no signed headers")
+	}
+	lines := make([]string, 0, len(names))
+	var date string
+	for _, name := range names {
+		value, ok := lookupEventHeader(req, name)
+		if !ok {
+			return "", invalidSignature("signed header %q is missing", name)
+		}
+		if (name == "x-date" || name == "date") && date == "" {
+			date = value
+		}
+		lines = append(lines, name+": "+value)
+	}
+	if date == "" {
+		return "", invalidSignature("the date is not signed")
+	}
+	signedAt, err := http.ParseTime(date)
+	if err != nil {
+		return "", invalidSignature("invalid date %q", date)
+	}
+	if skew := now.Sub(signedAt); skew > s.maxSkew || skew < -s.maxSkew {
+		return "", invalidSignature("date %q is stale", date)
+	}
+
+	secretKey, ok, err := s.keys.SecretKey(ctx, secretID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", invalidSignature("unknown secret ID %q", secretID)
+	}
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", invalidSignature("signature is not base64")
+	}
+	mac := hmac.New(newHash, []byte(secretKey))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	if !hmac.Equal(mac.Sum(nil), got) {
+		return "", invalidSignature("signature does not match")
+	}
+	return secretID, nil
+}
+
+// parseKeySignature parses the parameters of an hmac Authorization header.
+func parseKeySignature(authorization string) (map[string]string, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !strings.EqualFold(scheme, "hmac") {
+		return nil, invalidSignature("request is not signed")
+	}
+	params := map[string]string{}
+	for _, param := range strings.Split(rest, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return nil, invalidSignature("malformed parameter %q", param)
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return params, nil
+}
+
+func keySignatureHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case KeySignatureHMACSHA1:
+		return sha1.New, nil
+	case KeySignatureHMACSHA256:
+		return sha256.New, nil
+	}
+	return nil, invalidSignature("algorithm %q not supported", algorithm)
+}
+
+// lookupEventHeader is like eventHeader but reports whether the header is
+// present.
+func lookupEventHeader(req events.APIGatewayRequest, name string) (string, bool) {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// KeyPairAuthorization returns the Authorization header signing the X-Date
+// and Source headers of a request with an API Gateway key pair, with
+// hmac-sha1 as the API Gateway SDKs do. date is formatted like
+// http.TimeFormat.
+func KeyPairAuthorization(secretID, secretKey, date, source string) string {
+	mac := hmac.New(sha1.New, []byte(secretKey))
+	mac.Write([]byte("x-date: " + date + "\nsource: " + source))
+	return fmt.Sprintf(`hmac id="%s", algorithm="%s", headers="x-date source", signature="%s"`,
+		secretID, KeySignatureHMACSHA1, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+type verifiedSecretIDKey struct{}
+
+// GetVerifiedSecretIDFromContext retrieve the secret ID verified by
+// WithKeySignature from context.Context
+func GetVerifiedSecretIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(verifiedSecretIDKey{}).(string)
+	return id, ok
+}
@@ -0,0 +1,143 @@
+package core_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+type failingSecretKeys struct{}
+
+func (failingSecretKeys) SecretKey(context.Context, string) (string, bool, error) {
+	return "", false, errors.New("vault unavailable")
+}
+
+var _ = Describe("Key signature tests", func() {
+	var secretID string
+	var verified bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretID, verified = core.GetVerifiedSecretIDFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	accessor := core.NewRequestAccessor(core.WithKeySignature(core.KeySignatureConfig{
+		Keys:    core.StaticSecretKeys(map[string]string{"AKIDfirst": "first-key", "AKIDsecond": "second-key"}),
+		Exclude: []string{"/health"},
+	}))
+	serve := func(req events.APIGatewayRequest) events.APIGatewayResponse {
+		secretID, verified = "", false
+		resp, err := accessor.ServeEvent(handler, req)
+		Expect(err).To(BeNil())
+		return resp
+	}
+	signedAt := func(date time.Time) events.APIGatewayRequest {
+		d := date.UTC().Format(http.TimeFormat)
+		return coretest.NewEvent("GET", "/orders").
+			Header("X-Date", d).
+			Header("Source", "client").
+			Header("Authorization", core.KeyPairAuthorization("AKIDfirst", "first-key", d, "client")).
+			Build()
+	}
+
+	It("Accepts signed requests and exposes the secret ID", func() {
+		Expect(serve(coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDsecond", "second-key").Build()).StatusCode).To(Equal(http.StatusOK))
+		Expect(verified).To(BeTrue())
+		Expect(secretID).To(Equal("AKIDsecond"))
+
+		Expect(serve(signedAt(time.Now().Add(-10 * time.Minute))).StatusCode).To(Equal(http.StatusOK))
+		Expect(secretID).To(Equal("AKIDfirst"))
+	})
+
+	It("Accepts hmac-sha256 signatures over the date header", func() {
+		date := time.Now().UTC().Format(http.TimeFormat)
+		mac := hmac.New(sha256.New, []byte("first-key"))
+		mac.Write([]byte("date: " + date + "\nx-tenant: acme"))
+		req := coretest.NewEvent("POST", "/orders").
+			Header("date", date).
+			Header("X-Tenant", "acme").
+			Header("Authorization", fmt.Sprintf(`hmac id="AKIDfirst", algorithm="hmac-sha256", headers="date x-tenant", signature="%s"`,
+				base64.StdEncoding.EncodeToString(mac.Sum(nil)))).
+			Build()
+		Expect(serve(req).StatusCode).To(Equal(http.StatusOK))
+		Expect(secretID).To(Equal("AKIDfirst"))
+	})
+
+	It("Refuses unsigned, stale and forged requests", func() {
+		tampered := signedAt(time.Now())
+		tampered.Headers["Source"] = "other"
+		wrongKey := coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDfirst", "second-key").Build()
+		unknown := coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDother", "other-key").Build()
+		undated := coretest.NewEvent("GET", "/orders").
+			Header("Source", "client").
+			Header("Authorization", `hmac id="AKIDfirst", algorithm="hmac-sha1", headers="source", signature="c2lnbmF0dXJl"`).
+			Build()
+		wrongIdentity := coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDfirst", "first-key").SecretID("AKIDsecond").Build()
+
+		for name, req := range map[string]events.APIGatewayRequest{
+			"unsigned":       coretest.NewEvent("GET", "/orders").Build(),
+			"bearer":         coretest.NewEvent("GET", "/orders").Header("Authorization", "Bearer token").Build(),
+			"stale":          signedAt(time.Now().Add(-20 * time.Minute)),
+			"future":         signedAt(time.Now().Add(20 * time.Minute)),
+			"tampered":       tampered,
+			"wrong key":      wrongKey,
+			"unknown id":     unknown,
+			"undated":        undated,
+			"wrong identity": wrongIdentity,
+		} {
+			resp := serve(req)
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized), name)
+			Expect(resp.Headers).To(HaveKey("WWW-Authenticate"), name)
+			Expect(verified).To(BeFalse(), name)
+		}
+	})
+
+	It("Accepts the identity verified by the gateway when it matches", func() {
+		req := coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDfirst", "first-key").SecretID("AKIDfirst").Build()
+		Expect(serve(req).StatusCode).To(Equal(http.StatusOK))
+		Expect(secretID).To(Equal("AKIDfirst"))
+	})
+
+	It("Skips excluded paths", func() {
+		Expect(serve(coretest.NewEvent("GET", "/health").Build()).StatusCode).To(Equal(http.StatusOK))
+		Expect(verified).To(BeFalse())
+		for _, path := range []string{"/orders/../health", "/orders/%2e%2e/health", "/health/../orders"} {
+			Expect(serve(coretest.NewEvent("GET", path).Build()).StatusCode).To(Equal(http.StatusUnauthorized), path)
+		}
+	})
+
+	It("Returns an error when the keys cannot be loaded", func() {
+		accessor := core.NewRequestAccessor(core.WithKeySignature(core.KeySignatureConfig{Keys: failingSecretKeys{}}))
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", "/").SignKeyPair("AKIDfirst", "first-key").Build())
+		Expect(err).ToNot(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(func() { core.WithKeySignature(core.KeySignatureConfig{}) }).To(Panic())
+	})
+
+	It("Reads the JWT from the cookie when combined with JWT authentication", func() {
+		secret := []byte("secret")
+		token := signJWT("HS256", "", secret, map[string]interface{}{"sub": "user-1"})
+		both := core.NewRequestAccessor(
+			core.WithKeySignature(core.KeySignatureConfig{Keys: core.StaticSecretKeys(map[string]string{"AKIDfirst": "first-key"})}),
+			core.WithJWTAuth(core.JWTConfig{Keys: core.StaticJWTKeys(core.JWTKey{Key: secret}), Cookie: "session"}),
+		)
+		status := func(req events.APIGatewayRequest) int {
+			resp, err := both.ServeEvent(handler, req)
+			Expect(err).To(BeNil())
+			return resp.StatusCode
+		}
+
+		Expect(status(coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDfirst", "first-key").Header("Cookie", "session="+token).Build())).To(Equal(http.StatusOK))
+		Expect(status(coretest.NewEvent("GET", "/orders").SignKeyPair("AKIDfirst", "first-key").Build())).To(Equal(http.StatusUnauthorized))
+		Expect(status(coretest.NewEvent("GET", "/orders").Header("Authorization", "Bearer "+token).Build())).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/tencentyun/scf-go-lib/events"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans created by this
+// package.
+const tracerName = "github.com/linthan/scf-go-api-proxy/core"
+
+// Attribute keys set on the server span of every invocation, in addition
+// to the OpenTelemetry HTTP and FaaS semantic convention attributes.
+const (
+	AttributeAPIGatewayRequestID = attribute.Key("apigateway.request_id")
+	AttributeAPIGatewayStage     = attribute.Key("apigateway.stage")
+	AttributeAPIGatewayServiceID = attribute.Key("apigateway.service_id")
+)
+
+// WithTracerProvider enables OpenTelemetry tracing. Every event gets a
+// server span, named after the matched route, with child spans for the
+// event conversion, the handler and the response encoding. The span is
+// added to the request context, so handlers can create their own child
+// spans. A nil provider uses the global one from otel.GetTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		if tp == nil {
+			tp = otel.GetTracerProvider()
+		}
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithPropagator sets how the trace context of the caller is extracted from
+// the event headers. The default is the W3C traceparent/tracestate format.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// invocationSpan is the server span of an invocation. It does nothing when
+// tracing is disabled, so the caller's span in the context is left alone.
+type invocationSpan struct {
+	tracer trace.Tracer
+	span   trace.Span
+	method string
+}
+
+// noopSpan is shared by all invocations when tracing is disabled.
+var noopSpan = &invocationSpan{}
+
+func (c *config) startSpan(ctx context.Context, req events.APIGatewayRequest, inv *invocation) (context.Context, *invocationSpan) {
+	if c.tracer == nil {
+		return ctx, noopSpan
+	}
+
+	propagator := c.propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+	carrier := propagation.HeaderCarrier(http.Header{})
+	for k, v := range req.Headers {
+		carrier.Set(k, v)
+	}
+	ctx = propagator.Extract(ctx, carrier)
+
+	attrs := []attribute.KeyValue{
+		attribute.String("faas.trigger", "http"),
+		attribute.Bool("faas.coldstart", inv.coldStart),
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.Path),
+		AttributeAPIGatewayRequestID.String(req.Context.RequestID),
+		AttributeAPIGatewayStage.String(req.Context.Stage),
+		AttributeAPIGatewayServiceID.String(req.Context.ServiceID),
+	}
+	if req.Context.SourceIP != "" {
+		attrs = append(attrs, attribute.String("client.address", req.Context.SourceIP))
+	}
+	if lc, ok := functioncontext.FromContext(ctx); ok && lc != nil {
+		attrs = append(attrs, attribute.String("faas.invocation_id", lc.RequestID))
+	}
+
+	ctx, span := c.tracer.Start(ctx, req.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, &invocationSpan{tracer: c.tracer, span: span, method: req.Method}
+}
+
+// phase starts a child span for one step of the invocation. The returned
+// function ends it.
+func (s *invocationSpan) phase(ctx context.Context, name string) (context.Context, func()) {
+	if s.span == nil {
+		return ctx, func() {}
+	}
+	ctx, span := s.tracer.Start(ctx, name)
+	return ctx, func() { span.End() }
+}
+
+// end names the span after the route, records the outcome and ends it.
+func (s *invocationSpan) end(inv *invocation, status int, err error) {
+	if s.span == nil {
+		return
+	}
+	if inv.route != "" {
+		s.span.SetName(s.method + " " + inv.route)
+		s.span.SetAttributes(attribute.String("http.route", inv.route))
+	}
+	if status > 0 {
+		s.span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else if status >= 500 {
+		s.span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	s.span.End()
+}
@@ -0,0 +1,117 @@
+package core_test
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/functioncontext"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Tracing tests", func() {
+	var exporter *tracetest.InMemoryExporter
+	var provider *sdktrace.TracerProvider
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	})
+
+	spanNamed := func(name string) tracetest.SpanStub {
+		for _, s := range exporter.GetSpans() {
+			if s.Name == name {
+				return s
+			}
+		}
+		Fail("no span named " + name)
+		return tracetest.SpanStub{}
+	}
+
+	attributeOf := func(s tracetest.SpanStub, key attribute.Key) attribute.Value {
+		for _, kv := range s.Attributes {
+			if kv.Key == key {
+				return kv.Value
+			}
+		}
+		return attribute.Value{}
+	}
+
+	It("Creates a server span per event named after the route", func() {
+		accessor := core.NewRequestAccessor(core.WithTracerProvider(provider))
+		var handlerSpan trace.SpanContext
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerSpan = trace.SpanContextFromContext(r.Context())
+			core.SetRoute(r, "/users/{id}")
+			w.Write([]byte("ok"))
+		})
+
+		req := coretest.NewEvent("GET", "/users/1").Build()
+		req.Headers = map[string]string{
+			"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}
+		req.Context = getRequestContext()
+		ctx := functioncontext.NewContext(context.Background(), &functioncontext.FunctionContext{RequestID: "fn-1"})
+
+		resp, err := accessor.ServeEventWithContext(ctx, handler, req)
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(exporter.GetSpans()).To(HaveLen(4))
+		server := spanNamed("GET /users/{id}")
+		Expect(server.SpanKind).To(Equal(trace.SpanKindServer))
+		Expect(server.SpanContext.TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(server.Parent.SpanID().String()).To(Equal("00f067aa0ba902b7"))
+		Expect(attributeOf(server, core.AttributeAPIGatewayRequestID).AsString()).To(Equal("x"))
+		Expect(attributeOf(server, core.AttributeAPIGatewayStage).AsString()).To(Equal("prod"))
+		Expect(attributeOf(server, core.AttributeAPIGatewayServiceID).AsString()).To(Equal("x"))
+		Expect(attributeOf(server, "faas.invocation_id").AsString()).To(Equal("fn-1"))
+		Expect(attributeOf(server, "http.route").AsString()).To(Equal("/users/{id}"))
+		Expect(attributeOf(server, "http.response.status_code").AsInt64()).To(Equal(int64(200)))
+		Expect(attributeOf(server, "faas.coldstart").Type()).To(Equal(attribute.BOOL))
+
+		for _, name := range []string{"event.convert", "handler", "response.encode"} {
+			Expect(spanNamed(name).Parent.SpanID()).To(Equal(server.SpanContext.SpanID()))
+		}
+		Expect(handlerSpan.TraceID()).To(Equal(server.SpanContext.TraceID()))
+		Expect(handlerSpan.SpanID()).To(Equal(spanNamed("handler").SpanContext.SpanID()))
+	})
+
+	It("Marks failed invocations", func() {
+		accessor := core.NewRequestAccessor(core.WithTracerProvider(provider))
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+
+		_, err := accessor.ServeEvent(handler, coretest.NewEvent("POST", "/fail").Build())
+		Expect(err).To(BeNil())
+		Expect(spanNamed("POST").Status.Code).To(Equal(codes.Error))
+
+		_, err = accessor.ServeEvent(handler, coretest.NewEvent("BAD METHOD", "/fail").Build())
+		Expect(err).ToNot(BeNil())
+		Expect(spanNamed("BAD METHOD").Status.Code).To(Equal(codes.Error))
+	})
+
+	It("Leaves the caller's span alone when tracing is disabled", func() {
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "caller")
+		var handlerSpan trace.SpanContext
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlerSpan = trace.SpanContextFromContext(r.Context())
+			w.Write([]byte("ok"))
+		})
+
+		_, err := core.NewRequestAccessor().ServeEventWithContext(ctx, handler, coretest.NewEvent("GET", "/").Build())
+		Expect(err).To(BeNil())
+		parent.End()
+
+		Expect(handlerSpan).To(Equal(parent.SpanContext()))
+		Expect(exporter.GetSpans()).To(HaveLen(1))
+	})
+})
@@ -3,6 +3,8 @@ package core
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/tencentyun/scf-go-lib/events"
 )
@@ -12,6 +14,49 @@ func GatewayTimeout() events.APIGatewayResponse {
 	return events.APIGatewayResponse{StatusCode: http.StatusGatewayTimeout}
 }
 
+// ServiceUnavailable returns a default Service Unavailable (503) response
+func ServiceUnavailable() events.APIGatewayResponse {
+	return events.APIGatewayResponse{StatusCode: http.StatusServiceUnavailable}
+}
+
+// BadRequest returns a default Bad Request (400) response
+func BadRequest() events.APIGatewayResponse {
+	return events.APIGatewayResponse{StatusCode: http.StatusBadRequest}
+}
+
+// RequestEntityTooLarge returns a default Request Entity Too Large (413)
+// response
+func RequestEntityTooLarge() events.APIGatewayResponse {
+	return events.APIGatewayResponse{StatusCode: http.StatusRequestEntityTooLarge}
+}
+
+// Forbidden returns a default Forbidden (403) response
+func Forbidden() events.APIGatewayResponse {
+	return events.APIGatewayResponse{StatusCode: http.StatusForbidden}
+}
+
+// Unauthorized returns a default Unauthorized (401) response with the
+// challenge in a WWW-Authenticate header
+func Unauthorized(challenge string) events.APIGatewayResponse {
+	return events.APIGatewayResponse{
+		StatusCode: http.StatusUnauthorized,
+		Headers:    map[string]string{"WWW-Authenticate": challenge},
+	}
+}
+
+// TooManyRequests returns a default Too Many Requests (429) response, with
+// a Retry-After header in whole seconds, at least one
+func TooManyRequests(retryAfter time.Duration) events.APIGatewayResponse {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return events.APIGatewayResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Headers:    map[string]string{"Retry-After": strconv.Itoa(seconds)},
+	}
+}
+
 // NewLoggedError generates a new error and logs it to stdout
 func NewLoggedError(format string, a ...interface{}) error {
 	err := fmt.Errorf(format, a...)
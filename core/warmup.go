@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+// WarmupDetector reports whether an event is a warm-up ping sent to keep
+// the function instance alive, rather than a real request.
+type WarmupDetector func(req events.APIGatewayRequest) bool
+
+// WarmupCallback runs when a warm-up ping is received, for example to
+// ping a database pool. Errors are logged and do not fail the ping.
+type WarmupCallback func(ctx context.Context) error
+
+// WarmupHeader detects warm-up pings by the presence of a header with a
+// non-empty value. Any client can send the header through API Gateway;
+// prefer WarmupEmptyEvent, or pick a header the gateway sets or removes.
+func WarmupHeader(name string) WarmupDetector {
+	return func(req events.APIGatewayRequest) bool {
+		return eventHeader(req, name) != ""
+	}
+}
+
+// WarmupPath detects warm-up pings sent to the given path. Any client can
+// request the path through API Gateway.
+func WarmupPath(path string) WarmupDetector {
+	return func(req events.APIGatewayRequest) bool {
+		return req.Path == path
+	}
+}
+
+// WarmupEmptyEvent detects events that are not API Gateway requests at
+// all, such as the payload of a timer trigger, which decode to an event
+// without method and path. Clients cannot send those through API Gateway,
+// which makes it the only detector they cannot trigger.
+func WarmupEmptyEvent() WarmupDetector {
+	return func(req events.APIGatewayRequest) bool {
+		return req.Method == "" && req.Path == ""
+	}
+}
+
+type warmupConfig struct {
+	detectors []WarmupDetector
+	callbacks []WarmupCallback
+}
+
+// WithWarmup answers warm-up pings directly with 200 OK, without calling
+// the framework and without recording metrics, access logs or traces. The
+// event is a ping when any of the detectors matches. The callbacks run, in
+// order, for every ping.
+//
+// Pings are answered before the requests are authenticated, so a client
+// that matches a detector runs the OnInit hooks and the callbacks. Pings
+// that came through API Gateway are only answered when they pass
+// WithIPFilter and WithRateLimit; the others are served as normal requests.
+func WithWarmup(detectors []WarmupDetector, callbacks ...WarmupCallback) Option {
+	return func(c *config) {
+		c.warmup = &warmupConfig{detectors: detectors, callbacks: callbacks}
+	}
+}
+
+func (w *warmupConfig) matches(req events.APIGatewayRequest) bool {
+	for _, detect := range w.detectors {
+		if detect(req) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *warmupConfig) respond(ctx context.Context) events.APIGatewayResponse {
+	warm.Store(true)
+	for _, callback := range w.callbacks {
+		if err := callback(ctx); err != nil {
+			log.Printf("Warm-up callback failed: %v\n", err)
+		}
+	}
+	return events.APIGatewayResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{contentTypeHeaderKey: "application/json"},
+		Body:       `{"warmup":true}`,
+	}
+}
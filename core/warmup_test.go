@@ -0,0 +1,107 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+)
+
+var _ = Describe("Warm-up tests", func() {
+	var called bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	BeforeEach(func() {
+		called = false
+	})
+
+	It("Answers pings without calling the handler", func() {
+		sink := &core.MemoryMetricsSink{}
+		callbacks := 0
+		accessor := core.NewRequestAccessor(
+			core.WithMetrics(sink),
+			core.WithWarmup(
+				[]core.WarmupDetector{core.WarmupHeader("X-Warmup"), core.WarmupPath("/__warmup"), core.WarmupEmptyEvent()},
+				func(ctx context.Context) error {
+					callbacks++
+					return nil
+				},
+				func(ctx context.Context) error {
+					callbacks++
+					return errors.New("db ping failed")
+				},
+			),
+		)
+
+		pings := []events.APIGatewayRequest{
+			{Path: "/users", Method: "GET", Headers: map[string]string{"x-warmup": "1"}},
+			{Path: "/__warmup", Method: "GET"},
+			{},
+		}
+		for _, ping := range pings {
+			resp, err := accessor.ServeEventWithContext(context.Background(), handler, ping)
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Body).To(Equal(`{"warmup":true}`))
+		}
+		Expect(called).To(BeFalse())
+		Expect(callbacks).To(Equal(6))
+		Expect(sink.Metrics()).To(BeEmpty())
+
+		resp, err := accessor.ServeEvent(handler, coretest.NewEvent("GET", "/users").Build())
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(called).To(BeTrue())
+		Expect(sink.Metrics()).To(HaveLen(1))
+		Expect(sink.Metrics()[0].ColdStart).To(BeFalse())
+	})
+
+	It("Screens pings sent through API Gateway", func() {
+		callbacks := 0
+		accessor := core.NewRequestAccessor(
+			core.WithIPFilter(core.IPRule{Allow: []string{"10.0.0.0/8"}}),
+			core.WithRateLimit(core.RateLimitConfig{Limit: core.RateLimit{Requests: 1, Per: time.Minute}}),
+			core.WithWarmup(
+				[]core.WarmupDetector{core.WarmupHeader("X-Warmup"), core.WarmupEmptyEvent()},
+				func(ctx context.Context) error {
+					callbacks++
+					return nil
+				},
+			),
+		)
+		ping := func(sourceIP string) events.APIGatewayRequest {
+			req := coretest.NewEvent("GET", "/users").Build()
+			req.Headers = map[string]string{"X-Warmup": "1"}
+			req.Context.SourceIP = sourceIP
+			return req
+		}
+
+		resp, err := accessor.ServeEvent(handler, ping("1.2.3.4"))
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(callbacks).To(Equal(0))
+
+		resp, err = accessor.ServeEvent(handler, ping("10.0.0.1"))
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		resp, err = accessor.ServeEvent(handler, ping("10.0.0.1"))
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(callbacks).To(Equal(1))
+
+		resp, err = accessor.ServeEvent(handler, events.APIGatewayRequest{})
+		Expect(err).To(BeNil())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(callbacks).To(Equal(2))
+		Expect(called).To(BeFalse())
+	})
+})
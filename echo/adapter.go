@@ -6,6 +6,7 @@ package echoadapter
 import (
 	"context"
 	"net/http"
+	"reflect"
 
 	"github.com/labstack/echo/v4"
 	"github.com/linthan/scf-go-api-proxy/core"
@@ -16,47 +17,86 @@ import (
 // The library transforms the proxy event into an HTTP request and then
 // creates a proxy response object from the http.ResponseWriter
 type EchoLambda struct {
-	core.RequestAccessor
+	*core.RequestAccessor
 
+	// Echo is nil for adapters created with NewLazy.
 	Echo *echo.Echo
+	lazy *core.LazyInit[*echo.Echo]
 }
 
 // New creates a new instance of the EchoLambda object.
 // Receives an initialized *echo.Echo object - normally created with echo.New().
-// It returns the initialized instance of the EchoLambda object.
-func New(e *echo.Echo) *EchoLambda {
-	return &EchoLambda{Echo: e}
+// Options configure the embedded core.RequestAccessor, see core.Option.
+// It returns the initialized instance of the EchoLambda object, which is safe
+// for concurrent use by multiple goroutines.
+func New(e *echo.Echo, opts ...core.Option) *EchoLambda {
+	return &EchoLambda{RequestAccessor: core.NewRequestAccessor(opts...), Echo: e}
+}
+
+// NewLazy creates a new instance of the EchoLambda object that builds its
+// *echo.Echo with factory when the first event arrives, so that expensive
+// setup is not paid before the function is invoked. Events fail with 503
+// Service Unavailable while the factory returns an error, and the factory
+// is retried on the next event.
+func NewLazy(factory func() (*echo.Echo, error), opts ...core.Option) *EchoLambda {
+	return &EchoLambda{RequestAccessor: core.NewRequestAccessor(opts...), lazy: core.NewLazyInit(factory)}
 }
 
 // Proxy receives an API Gateway proxy event, transforms it into an http.Request
 // object, and sends it to the echo.Echo for routing.
 // It returns a proxy response object generated from the http.ResponseWriter.
+// Handlers must not keep the http.ResponseWriter after they return, it is
+// reused for later events.
 func (e *EchoLambda) Proxy(req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
-	echoRequest, err := e.ProxyEventToHTTPRequest(req)
-	return e.proxyInternal(echoRequest, err)
+	return e.ServeEvent(http.HandlerFunc(e.serveHTTP), req)
 }
 
 // ProxyWithContext receives context and an API Gateway proxy event,
 // transforms them into an http.Request object, and sends it to the echo.Echo for routing.
 // It returns a proxy response object generated from the http.ResponseWriter.
+// Handlers must not keep the http.ResponseWriter after they return, it is
+// reused for later events.
 func (e *EchoLambda) ProxyWithContext(ctx context.Context, req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
-	echoRequest, err := e.EventToRequestWithContext(ctx, req)
-	return e.proxyInternal(echoRequest, err)
+	return e.ServeEventWithContext(ctx, http.HandlerFunc(e.serveHTTP), req)
 }
 
-func (e *EchoLambda) proxyInternal(req *http.Request, err error) (events.APIGatewayResponse, error) {
-
-	if err != nil {
-		return core.GatewayTimeout(), core.NewLoggedError("Could not convert proxy event to request: %v", err)
+// serveHTTP records the route template of the request, when it is used,
+// before handing it to echo, which recycles its context as soon as the
+// request is served.
+func (e *EchoLambda) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	ec := e.Echo
+	if e.lazy != nil {
+		var err error
+		if ec, err = e.lazy.Get(req.Context()); err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
 	}
+	if core.WantsRoute(req) {
+		setRoute(ec, req)
+	}
+	ec.ServeHTTP(w, req)
+}
 
-	respWriter := core.NewProxyResponseWriter()
-	e.Echo.ServeHTTP(http.ResponseWriter(respWriter), req)
-
-	proxyResponse, err := respWriter.GetProxyResponse()
-	if err != nil {
-		return core.GatewayTimeout(), core.NewLoggedError("Error while generating proxy response: %v", err)
+// setRoute records the route template echo selects for the request. The
+// route is looked up before echo serves the request, so rewrites made by
+// Pre middleware are not taken into account.
+func setRoute(ec *echo.Echo, req *http.Request) {
+	path := req.URL.RawPath
+	if path == "" {
+		path = req.URL.Path
 	}
+	c := ec.NewContext(req, nil)
+	c.SetHandler(nil)
+	ec.Router().Find(req.Method, path, c)
+	// without a route for the method, Path is the raw request path or the
+	// template of a route registered for other methods
+	if h := c.Handler(); h != nil && !isHandler(h, echo.NotFoundHandler) && !isHandler(h, echo.MethodNotAllowedHandler) {
+		core.SetRoute(req, c.Path())
+	}
+}
 
-	return proxyResponse, nil
+// isHandler reports whether h is the handler function want.
+func isHandler(h, want echo.HandlerFunc) bool {
+	return reflect.ValueOf(h).Pointer() == reflect.ValueOf(want).Pointer()
 }
@@ -0,0 +1,36 @@
+package echoadapter_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	echoadapter "github.com/linthan/scf-go-api-proxy/echo"
+)
+
+func BenchmarkProxyWithContext(b *testing.B) {
+	e := echo.New()
+	e.POST("/orders/:id", func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.Blob(200, "application/json", body)
+	})
+	adapter := echoadapter.New(e)
+	event := coretest.NewEvent("POST", "/orders/42").
+		Header("Content-Type", "application/json").
+		Header("Accept", "application/json").
+		Query("expand", "items").
+		Body(`{"id":42,"name":"gopher","tags":["serverless","api","go"]}`).
+		Build()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := adapter.ProxyWithContext(ctx, event)
+		if err != nil || resp.StatusCode != 200 {
+			b.Fatal(resp, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package echoadapter
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/linthan/scf-go-api-proxy/core"
+)
+
+// GetInvocationInfo returns the function invocation serving the request of
+// the echo context, see core.GetInvocationInfoFromContext.
+func GetInvocationInfo(c echo.Context) (core.InvocationInfo, bool) {
+	return core.GetInvocationInfo(c.Request())
+}
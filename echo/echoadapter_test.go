@@ -1,13 +1,23 @@
 package echoadapter_test
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"strconv"
+	"sync"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
 
 	"github.com/labstack/echo/v4"
 	echoadapter "github.com/linthan/scf-go-api-proxy/echo"
-	"github.com/tencentyun/scf-go-lib/events"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/tencentyun/scf-go-lib/events"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ = Describe("EchoLambda tests", func() {
@@ -31,4 +41,233 @@ var _ = Describe("EchoLambda tests", func() {
 			Expect(resp.StatusCode).To(Equal(200))
 		})
 	})
+
+	Context("Concurrent invocations", func() {
+		It("Serves parallel events without sharing state", func() {
+			e := echo.New()
+			e.GET("/echo/:id", func(c echo.Context) error {
+				apiGwContext, _ := core.GetAPIGatewayContextFromContext(c.Request().Context())
+				return c.String(200, c.Param("id")+":"+c.QueryParam("id")+":"+apiGwContext.RequestID)
+			})
+
+			adapter := echoadapter.New(e, core.WithBasePath("/api"))
+
+			const invocations = 500
+			var wg sync.WaitGroup
+			errs := make(chan error, invocations)
+			for i := 0; i < invocations; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					id := strconv.Itoa(i)
+					req := coretest.NewEvent("GET", "/api/echo/"+id).Query("id", id).RequestID(id).Stage("prod").Build()
+					resp, err := adapter.ProxyWithContext(context.Background(), req)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if resp.StatusCode != 200 || resp.Body != id+":"+id+":"+id {
+						errs <- fmt.Errorf("invocation %s got %d %q", id, resp.StatusCode, resp.Body)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				Expect(err).To(BeNil())
+			}
+		})
+	})
+
+	Context("Route templates", func() {
+		It("Names spans after the matched route", func() {
+			e := echo.New()
+			e.GET("/users/:id", func(c echo.Context) error {
+				return c.String(200, c.Param("id"))
+			})
+			e.GET("/users/me", func(c echo.Context) error {
+				return c.String(200, "me")
+			})
+
+			exporter := tracetest.NewInMemoryExporter()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			adapter := echoadapter.New(e, core.WithTracerProvider(provider))
+
+			for _, path := range []string{"/users/42", "/users/me"} {
+				resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", path).Build())
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(Equal(200))
+			}
+
+			names := []string{}
+			for _, span := range exporter.GetSpans() {
+				if span.SpanKind == trace.SpanKindServer {
+					names = append(names, span.Name)
+				}
+			}
+			Expect(names).To(Equal([]string{"GET /users/:id", "GET /users/me"}))
+		})
+	})
+
+	Context("Metrics", func() {
+		It("Records the route template and status", func() {
+			e := echo.New()
+			e.GET("/orders/:id", func(c echo.Context) error {
+				return c.String(200, c.Param("id"))
+			})
+			sink := &core.MemoryMetricsSink{}
+			adapter := echoadapter.New(e, core.WithMetrics(sink))
+
+			_, err := adapter.Proxy(coretest.NewEvent("GET", "/orders/7").Build())
+			Expect(err).To(BeNil())
+			_, err = adapter.Proxy(coretest.NewEvent("GET", "/missing").Build())
+			Expect(err).To(BeNil())
+
+			metrics := sink.Metrics()
+			Expect(metrics).To(HaveLen(2))
+			Expect(metrics[0].Route).To(Equal("/orders/:id"))
+			Expect(metrics[0].Status).To(Equal(200))
+			Expect(metrics[0].ResponseBytes).To(Equal(1))
+			Expect(metrics[1].Route).To(Equal(""))
+			Expect(metrics[1].Status).To(Equal(404))
+		})
+
+		It("Leaves the route empty for methods the route does not handle", func() {
+			e := echo.New()
+			e.GET("/orders/:id", func(c echo.Context) error {
+				return c.String(200, c.Param("id"))
+			})
+			sink := &core.MemoryMetricsSink{}
+			adapter := echoadapter.New(e, core.WithMetrics(sink))
+
+			_, err := adapter.Proxy(coretest.NewEvent("DELETE", "/orders/7").Build())
+			Expect(err).To(BeNil())
+
+			metrics := sink.Metrics()
+			Expect(metrics).To(HaveLen(1))
+			Expect(metrics[0].Status).To(Equal(405))
+			Expect(metrics[0].Route).To(Equal(""))
+		})
+	})
+
+	Context("Lazy initialization", func() {
+		It("Builds the echo instance on the first event", func() {
+			built := false
+			adapter := echoadapter.NewLazy(func() (*echo.Echo, error) {
+				built = true
+				e := echo.New()
+				e.GET("/ping", func(c echo.Context) error {
+					return c.String(200, "pong")
+				})
+				return e, nil
+			})
+			Expect(built).To(BeFalse())
+
+			resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", "/ping").Build())
+			Expect(err).To(BeNil())
+			Expect(built).To(BeTrue())
+			Expect(resp.Body).To(Equal("pong"))
+		})
+	})
+
+	Context("CORS", func() {
+		It("Answers preflights for routes without OPTIONS handlers", func() {
+			e := echo.New()
+			e.GET("/orders", func(c echo.Context) error {
+				return c.String(200, "orders")
+			})
+			adapter := echoadapter.New(e, core.WithCORS(core.CORSConfig{AllowOrigins: []string{"https://app.example.com"}}))
+
+			resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("OPTIONS", "/orders").
+				Header("Origin", "https://app.example.com").
+				Header("Access-Control-Request-Method", "GET").
+				Build())
+			Expect(err).To(BeNil())
+			Expect(resp).To(coretest.HaveStatus(204))
+			Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Origin", "https://app.example.com"))
+
+			resp, err = adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", "/missing").
+				Header("Origin", "https://app.example.com").
+				Build())
+			Expect(err).To(BeNil())
+			Expect(resp).To(coretest.HaveStatus(404))
+			Expect(resp).To(coretest.HaveHeader("Access-Control-Allow-Origin", "https://app.example.com"))
+		})
+	})
+
+	Context("Invocation info", func() {
+		It("Reads the function context from the echo context", func() {
+			e := echo.New()
+			e.GET("/info", func(c echo.Context) error {
+				info, ok := echoadapter.GetInvocationInfo(c)
+				if !ok {
+					return c.NoContent(500)
+				}
+				return c.String(200, info.FunctionName+" "+strconv.Itoa(info.MemoryLimitInMB))
+			})
+			adapter := echoadapter.New(e)
+
+			ctx, cancel := coretest.NewContext(context.Background(), nil)
+			defer cancel()
+			resp, err := adapter.ProxyWithContext(ctx, coretest.NewEvent("GET", "/info").Build())
+			Expect(err).To(BeNil())
+			Expect(resp).To(coretest.HaveBody("test-function 128"))
+		})
+	})
+
+	Context("Path rules", func() {
+		newApp := func() *echo.Echo {
+			e := echo.New()
+			e.GET("/admin/*", func(c echo.Context) error {
+				return c.String(200, "admin")
+			})
+			e.GET("/*", func(c echo.Context) error {
+				return c.String(200, "public")
+			})
+			return e
+		}
+		proxy := func(adapter *echoadapter.EchoLambda, path string) int {
+			resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", path).SourceIP("1.2.3.4").Build())
+			Expect(err).To(BeNil())
+			return resp.StatusCode
+		}
+
+		It("Applies IP rules to dot segment and encoded paths", func() {
+			adapter := echoadapter.New(newApp(), core.WithIPFilter(core.IPRule{PathPrefix: "/admin", Allow: []string{"10.0.0.0/8"}}))
+			for _, path := range []string{"/admin/x", "/admin/../x", "/admin/%2e%2e/x", "/%61dmin/x", "/x/../admin/y", "//admin/x"} {
+				Expect(proxy(adapter, path)).To(Equal(403), path)
+			}
+			Expect(proxy(adapter, "/x")).To(Equal(200))
+		})
+
+		It("Authenticates dot segment paths reaching protected routes", func() {
+			e := newApp()
+			e.GET("/health", func(c echo.Context) error {
+				return c.String(200, "ok")
+			})
+			adapter := echoadapter.New(e, core.WithJWTAuth(core.JWTConfig{
+				Keys:    core.StaticJWTKeys(core.JWTKey{Key: []byte("secret")}),
+				Exclude: []string{"/health"},
+			}))
+			Expect(proxy(adapter, "/health")).To(Equal(200))
+			for _, path := range []string{"/admin/../health", "/admin/%2e%2e/health", "/admin%2F..%2Fhealth"} {
+				Expect(proxy(adapter, path)).To(Equal(401), path)
+			}
+		})
+
+		It("Verifies signatures of dot segment paths reaching protected routes", func() {
+			e := newApp()
+			e.GET("/health", func(c echo.Context) error {
+				return c.String(200, "ok")
+			})
+			adapter := echoadapter.New(e, core.WithKeySignature(core.KeySignatureConfig{
+				Keys:    core.StaticSecretKeys(map[string]string{"AKIDexample": "secret"}),
+				Exclude: []string{"/health"},
+			}))
+			Expect(proxy(adapter, "/health")).To(Equal(200))
+			for _, path := range []string{"/admin/../health", "/admin/%2e%2e/health", "/admin%2F..%2Fhealth"} {
+				Expect(proxy(adapter, path)).To(Equal(401), path)
+			}
+		})
+	})
 })
@@ -16,47 +16,59 @@ import (
 // Engine. The library transforms the proxy event into an HTTP request and then
 // creates a proxy response object from the http.ResponseWriter
 type GinLambda struct {
-	core.RequestAccessor
+	*core.RequestAccessor
 
 	ginEngine *gin.Engine
+	lazy      *core.LazyInit[*gin.Engine]
 }
 
 // New creates a new instance of the GinLambda object.
 // Receives an initialized *gin.Engine object - normally created with gin.Default().
-// It returns the initialized instance of the GinLambda object.
-func New(gin *gin.Engine) *GinLambda {
-	return &GinLambda{ginEngine: gin}
+// Options configure the embedded core.RequestAccessor, see core.Option.
+// It returns the initialized instance of the GinLambda object, which is safe
+// for concurrent use by multiple goroutines.
+func New(gin *gin.Engine, opts ...core.Option) *GinLambda {
+	return &GinLambda{RequestAccessor: core.NewRequestAccessor(opts...), ginEngine: gin}
+}
+
+// NewLazy creates a new instance of the GinLambda object that builds its
+// *gin.Engine with factory when the first event arrives, so that expensive
+// setup is not paid before the function is invoked. Events fail with 503
+// Service Unavailable while the factory returns an error, and the factory
+// is retried on the next event.
+func NewLazy(factory func() (*gin.Engine, error), opts ...core.Option) *GinLambda {
+	return &GinLambda{RequestAccessor: core.NewRequestAccessor(opts...), lazy: core.NewLazyInit(factory)}
 }
 
 // Proxy receives an API Gateway proxy event, transforms it into an http.Request
 // object, and sends it to the gin.Engine for routing.
 // It returns a proxy response object generated from the http.ResponseWriter.
+// Handlers must not keep the http.ResponseWriter after they return, it is
+// reused for later events.
 func (g *GinLambda) Proxy(req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
-	ginRequest, err := g.ProxyEventToHTTPRequest(req)
-	return g.proxyInternal(ginRequest, err)
+	return g.ServeEvent(http.HandlerFunc(g.serveHTTP), req)
 }
 
 // ProxyWithContext receives context and an API Gateway proxy event,
 // transforms them into an http.Request object, and sends it to the gin.Engine for routing.
 // It returns a proxy response object generated from the http.ResponseWriter.
+// Handlers must not keep the http.ResponseWriter after they return, it is
+// reused for later events.
 func (g *GinLambda) ProxyWithContext(ctx context.Context, req events.APIGatewayRequest) (events.APIGatewayResponse, error) {
-	ginRequest, err := g.EventToRequestWithContext(ctx, req)
-	return g.proxyInternal(ginRequest, err)
+	return g.ServeEventWithContext(ctx, http.HandlerFunc(g.serveHTTP), req)
 }
 
-func (g *GinLambda) proxyInternal(req *http.Request, err error) (events.APIGatewayResponse, error) {
-
-	if err != nil {
-		return core.GatewayTimeout(), core.NewLoggedError("Could not convert proxy event to request: %v", err)
+func (g *GinLambda) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	engine := g.ginEngine
+	if g.lazy != nil {
+		var err error
+		if engine, err = g.lazy.Get(req.Context()); err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
 	}
-
-	respWriter := core.NewProxyResponseWriter()
-	g.ginEngine.ServeHTTP(http.ResponseWriter(respWriter), req)
-
-	proxyResponse, err := respWriter.GetProxyResponse()
-	if err != nil {
-		return core.GatewayTimeout(), core.NewLoggedError("Error while generating proxy response: %v", err)
+	engine.ServeHTTP(w, req)
+	if core.WantsRoute(req) {
+		core.SetRoute(req, routeOf(engine, req))
 	}
-
-	return proxyResponse, nil
 }
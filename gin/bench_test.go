@@ -0,0 +1,37 @@
+package ginadapter_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
+	ginadapter "github.com/linthan/scf-go-api-proxy/gin"
+)
+
+func BenchmarkProxyWithContext(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	engine.POST("/orders/:id", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(200, "application/json", body)
+	})
+	adapter := ginadapter.New(engine)
+	event := coretest.NewEvent("POST", "/orders/42").
+		Header("Content-Type", "application/json").
+		Header("Accept", "application/json").
+		Query("expand", "items").
+		Body(`{"id":42,"name":"gopher","tags":["serverless","api","go"]}`).
+		Build()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := adapter.ProxyWithContext(ctx, event)
+		if err != nil || resp.StatusCode != 200 {
+			b.Fatal(resp, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package ginadapter
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/linthan/scf-go-api-proxy/core"
+)
+
+// GetInvocationInfo returns the function invocation serving the request of
+// the gin context, see core.GetInvocationInfoFromContext.
+func GetInvocationInfo(c *gin.Context) (core.InvocationInfo, bool) {
+	return core.GetInvocationInfo(c.Request)
+}
@@ -2,11 +2,23 @@ package ginadapter_test
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"log"
+	"strconv"
+	"sync"
+
+	"github.com/linthan/scf-go-api-proxy/core"
+	"github.com/linthan/scf-go-api-proxy/core/coretest"
 
 	"github.com/gin-gonic/gin"
 	ginadapter "github.com/linthan/scf-go-api-proxy/gin"
 	"github.com/tencentyun/scf-go-lib/events"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -42,4 +54,147 @@ var _ = Describe("GinLambda tests", func() {
 			Expect(resp.StatusCode).To(Equal(200))
 		})
 	})
+
+	Context("Concurrent invocations", func() {
+		It("Serves parallel events without sharing state", func() {
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			r.GET("/echo/:id", func(c *gin.Context) {
+				apiGwContext, _ := core.GetAPIGatewayContextFromContext(c.Request.Context())
+				c.String(200, c.Param("id")+":"+c.Query("id")+":"+apiGwContext.RequestID)
+			})
+
+			adapter := ginadapter.New(r, core.WithBasePath("/api"))
+
+			const invocations = 500
+			var wg sync.WaitGroup
+			errs := make(chan error, invocations)
+			for i := 0; i < invocations; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					id := strconv.Itoa(i)
+					req := coretest.NewEvent("GET", "/api/echo/"+id).Query("id", id).RequestID(id).Stage("prod").Build()
+					resp, err := adapter.ProxyWithContext(context.Background(), req)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if resp.StatusCode != 200 || resp.Body != id+":"+id+":"+id {
+						errs <- fmt.Errorf("invocation %s got %d %q", id, resp.StatusCode, resp.Body)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				Expect(err).To(BeNil())
+			}
+		})
+	})
+
+	Context("Route templates", func() {
+		It("Names spans after the matched route", func() {
+			gin.SetMode(gin.ReleaseMode)
+			r := gin.New()
+			r.GET("/users/:id", func(c *gin.Context) {
+				c.String(200, c.Param("id"))
+			})
+			r.GET("/files/*path", func(c *gin.Context) {
+				c.String(200, c.Param("path"))
+			})
+
+			exporter := tracetest.NewInMemoryExporter()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			adapter := ginadapter.New(r, core.WithTracerProvider(provider))
+
+			for _, path := range []string{"/users/42", "/files/a/b"} {
+				resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", path).Build())
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(Equal(200))
+			}
+
+			names := []string{}
+			for _, span := range exporter.GetSpans() {
+				if span.SpanKind == trace.SpanKindServer {
+					names = append(names, span.Name)
+				}
+			}
+			Expect(names).To(Equal([]string{"GET /users/:id", "GET /files/*path"}))
+		})
+	})
+
+	Context("Lazy initialization", func() {
+		It("Builds the engine on the first event", func() {
+			built := false
+			adapter := ginadapter.NewLazy(func() (*gin.Engine, error) {
+				built = true
+				r := gin.New()
+				r.GET("/ping", func(c *gin.Context) {
+					c.String(200, "pong")
+				})
+				return r, nil
+			})
+			Expect(built).To(BeFalse())
+
+			resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", "/ping").Build())
+			Expect(err).To(BeNil())
+			Expect(built).To(BeTrue())
+			Expect(resp.Body).To(Equal("pong"))
+		})
+	})
+
+	Context("JWT authentication", func() {
+		It("Exposes the verified claims to handlers", func() {
+			secret := []byte("secret")
+			signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+				base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`))
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(signed))
+			token := signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+			r := gin.New()
+			r.GET("/me", func(c *gin.Context) {
+				claims, ok := core.GetJWTClaimsFromContext(c.Request.Context())
+				if !ok {
+					c.Status(500)
+					return
+				}
+				c.String(200, claims.Subject)
+			})
+			adapter := ginadapter.New(r, core.WithJWTAuth(core.JWTConfig{Keys: core.StaticJWTKeys(core.JWTKey{Key: secret})}))
+
+			resp, err := adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", "/me").
+				Header("Authorization", "Bearer "+token).
+				Build())
+			Expect(err).To(BeNil())
+			Expect(resp).To(coretest.HaveStatus(200))
+			Expect(resp).To(coretest.HaveBody("user-1"))
+
+			resp, err = adapter.ProxyWithContext(context.Background(), coretest.NewEvent("GET", "/me").Build())
+			Expect(err).To(BeNil())
+			Expect(resp).To(coretest.HaveStatus(401))
+		})
+	})
+
+	Context("Invocation info", func() {
+		It("Reads the function context from the gin context", func() {
+			r := gin.New()
+			r.GET("/info", func(c *gin.Context) {
+				info, ok := ginadapter.GetInvocationInfo(c)
+				if !ok {
+					c.Status(500)
+					return
+				}
+				c.String(200, info.FunctionName+" "+strconv.Itoa(info.MemoryLimitInMB))
+			})
+			adapter := ginadapter.New(r)
+
+			ctx, cancel := coretest.NewContext(context.Background(), nil)
+			defer cancel()
+			resp, err := adapter.ProxyWithContext(ctx, coretest.NewEvent("GET", "/info").Build())
+			Expect(err).To(BeNil())
+			Expect(resp).To(coretest.HaveBody("test-function 128"))
+		})
+	})
 })
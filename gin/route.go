@@ -0,0 +1,77 @@
+package ginadapter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of route segments, in the order gin's router prefers them.
+const (
+	catchAllSegment = iota
+	paramSegment
+	staticSegment
+)
+
+// routeOf returns the template of the route that gin selects for the
+// request, for example "/users/:id", or an empty string if none matches.
+// gin does not expose the matched template on the context in this version,
+// so the registered routes are matched again here.
+func routeOf(engine *gin.Engine, req *http.Request) string {
+	path := req.URL.Path
+	if engine.UseRawPath && req.URL.RawPath != "" {
+		path = req.URL.RawPath
+	}
+
+	best := ""
+	var bestKinds []int
+	for _, route := range engine.Routes() {
+		if route.Method != req.Method {
+			continue
+		}
+		kinds, ok := matchRoute(route.Path, path)
+		if ok && (bestKinds == nil || preferRoute(kinds, bestKinds)) {
+			best, bestKinds = route.Path, kinds
+		}
+	}
+	return best
+}
+
+// matchRoute reports whether path matches the route template and returns
+// the kind of each template segment.
+func matchRoute(template string, path string) ([]int, bool) {
+	templateSegments := strings.Split(template, "/")
+	pathSegments := strings.Split(path, "/")
+	kinds := make([]int, 0, len(templateSegments))
+	for i, segment := range templateSegments {
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			return append(kinds, catchAllSegment), i <= len(pathSegments)
+		case i >= len(pathSegments):
+			return nil, false
+		case strings.HasPrefix(segment, ":"):
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			kinds = append(kinds, paramSegment)
+		case segment != pathSegments[i]:
+			return nil, false
+		default:
+			kinds = append(kinds, staticSegment)
+		}
+	}
+	return kinds, len(templateSegments) == len(pathSegments)
+}
+
+// preferRoute reports whether a route with the segment kinds a wins over
+// one with the segment kinds b: static segments beat parameters, which
+// beat catch-all segments, from left to right.
+func preferRoute(a []int, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return len(a) > len(b)
+}
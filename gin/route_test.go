@@ -0,0 +1,30 @@
+package ginadapter
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Route matching tests", func() {
+	It("Matches static, parameter and catch-all segments", func() {
+		_, ok := matchRoute("/users/:id", "/users/42")
+		Expect(ok).To(BeTrue())
+		_, ok = matchRoute("/users/:id", "/users/")
+		Expect(ok).To(BeFalse())
+		_, ok = matchRoute("/users/:id", "/users/42/posts")
+		Expect(ok).To(BeFalse())
+		_, ok = matchRoute("/files/*path", "/files/a/b/c")
+		Expect(ok).To(BeTrue())
+		_, ok = matchRoute("/ping", "/pong")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Prefers static segments over parameters and catch-alls", func() {
+		static, _ := matchRoute("/users/me", "/users/me")
+		param, _ := matchRoute("/users/:id", "/users/me")
+		catchAll, _ := matchRoute("/users/*rest", "/users/me")
+		Expect(preferRoute(static, param)).To(BeTrue())
+		Expect(preferRoute(param, static)).To(BeFalse())
+		Expect(preferRoute(param, catchAll)).To(BeTrue())
+	})
+})